@@ -0,0 +1,63 @@
+package base
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A single attachment transfer, recorded by AttachmentTransferLog.
+type AttachmentTransfer struct {
+	DocID    string        `json:"doc_id"`
+	Digest   string        `json:"digest"`
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// AttachmentTransferLog retains the largest attachment transfers seen, up to a fixed number, to attribute attachment
+// bytes to the docs being synced when diagnosing slow replications.  Doc IDs make this unsuitable for Prometheus, so
+// it's only exposed via expvars.
+type AttachmentTransferLog struct {
+	lock      sync.Mutex
+	size      int
+	transfers []AttachmentTransfer // Ordered by descending Size
+}
+
+func NewAttachmentTransferLog(size int) *AttachmentTransferLog {
+	return &AttachmentTransferLog{
+		size:      size,
+		transfers: make([]AttachmentTransfer, 0, size),
+	}
+}
+
+// Records the transfer if it's one of the largest seen.  No-op for a nil log, so callers don't need to check whether
+// transfers are being recorded.
+func (l *AttachmentTransferLog) Add(transfer AttachmentTransfer) {
+	if l == nil || l.size <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.transfers) == l.size && transfer.Size <= l.transfers[len(l.transfers)-1].Size {
+		return
+	}
+	i := sort.Search(len(l.transfers), func(i int) bool { return l.transfers[i].Size < transfer.Size })
+	if len(l.transfers) < l.size {
+		l.transfers = append(l.transfers, AttachmentTransfer{})
+	}
+	copy(l.transfers[i+1:], l.transfers[i:])
+	l.transfers[i] = transfer
+}
+
+// Returns a copy of the recorded transfers, largest first.
+func (l *AttachmentTransferLog) Transfers() []AttachmentTransfer {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]AttachmentTransfer{}, l.transfers...)
+}
+
+func (l *AttachmentTransferLog) MarshalJSON() ([]byte, error) {
+	return JSONMarshal(l.Transfers())
+}
@@ -0,0 +1,34 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentTransferLog(t *testing.T) {
+	log := NewAttachmentTransferLog(3)
+	for i, size := range []int64{10, 50, 20, 5, 40, 30} {
+		log.Add(AttachmentTransfer{DocID: "doc", Digest: string(rune('a' + i)), Size: size})
+	}
+
+	transfers := log.Transfers()
+	require.Len(t, transfers, 3)
+	assert.Equal(t, int64(50), transfers[0].Size)
+	assert.Equal(t, int64(40), transfers[1].Size)
+	assert.Equal(t, int64(30), transfers[2].Size)
+
+	// Transfers no larger than the smallest retained one are dropped once full
+	log.Add(AttachmentTransfer{DocID: "small", Size: 30})
+	assert.Equal(t, transfers, log.Transfers())
+
+	data, err := JSONMarshal(log)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"doc_id":"doc","digest":"b","size":50,"duration_ns":0},{"doc_id":"doc","digest":"e","size":40,"duration_ns":0},{"doc_id":"doc","digest":"f","size":30,"duration_ns":0}]`, string(data))
+}
+
+func TestAttachmentTransferLogNil(t *testing.T) {
+	var log *AttachmentTransferLog
+	assert.NotPanics(t, func() { log.Add(AttachmentTransfer{DocID: "doc", Size: 10}) })
+}
@@ -10,6 +10,7 @@
 package base
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -436,6 +437,43 @@ func Tracef(logKey LogKey, format string, args ...interface{}) {
 	logTo(context.TODO(), LevelTrace, logKey, format, args...)
 }
 
+// JSONLogging enables logging of key events (see LogEventCtx) as JSON objects, for consumption by log aggregation tools.
+var JSONLogging bool
+
+// LogEventCtx logs a key event.  When JSONLogging is enabled, the event is logged as a JSON object containing an
+// "event" property and the given fields, with any Redactor values redacted.  Otherwise the given formatted string
+// and args are logged, as for the other logging functions.
+func LogEventCtx(ctx context.Context, logLevel LogLevel, logKey LogKey, event string, fields map[string]interface{}, format string, args ...interface{}) {
+	if !JSONLogging {
+		logTo(ctx, logLevel, logKey, format, args...)
+		return
+	}
+
+	// Avoid building the event when it's not going to be logged anywhere.
+	if !shouldLog(logLevel, logKey) {
+		return
+	}
+
+	eventBody := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		if r, ok := v.(Redactor); ok {
+			v = r.Redact()
+		}
+		eventBody[k] = v
+	}
+	eventBody["event"] = event
+
+	// Don't escape redaction tags
+	var eventJSON bytes.Buffer
+	encoder := JSONEncoder(&eventJSON)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(eventBody); err != nil {
+		logTo(ctx, logLevel, logKey, format, args...)
+		return
+	}
+	logTo(ctx, logLevel, logKey, "%s", bytes.TrimSpace(eventJSON.Bytes()))
+}
+
 // RecordStats writes the given stats JSON content to a stats log file, if enabled.
 // The content passed in is expected to be a JSON dictionary.
 func RecordStats(statsJson string) {
@@ -444,6 +482,19 @@ func RecordStats(statsJson string) {
 	}
 }
 
+// shouldLog returns true if any of the outputs would log at the given level and log key.
+func shouldLog(logLevel LogLevel, logKey LogKey) bool {
+	if logLevel < LevelNone || logLevel >= levelCount {
+		return false
+	}
+	return consoleLogger.shouldLog(logLevel, logKey) ||
+		errorLogger.shouldLog(logLevel) ||
+		warnLogger.shouldLog(logLevel) ||
+		infoLogger.shouldLog(logLevel) ||
+		debugLogger.shouldLog(logLevel) ||
+		traceLogger.shouldLog(logLevel)
+}
+
 // logTo is the "core" logging function. All other logging functions (like Debugf(), WarnfCtx(), etc.) end up here.
 // The function will fan out the log to all of the various outputs for them to decide if they should log it or not.
 func logTo(ctx context.Context, logLevel LogLevel, logKey LogKey, format string, args ...interface{}) {
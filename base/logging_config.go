@@ -43,6 +43,7 @@ type LoggingConfig struct {
 	Trace                FileLoggerConfig    `json:"trace,omitempty"`           // Trace log file output
 	Stats                FileLoggerConfig    `json:"stats,omitempty"`           // Stats log file output
 	DeprecatedDefaultLog *LogAppenderConfig  `json:"default,omitempty"`         // Deprecated "default" logging option.
+	JSON                 bool                `json:"json,omitempty"`            // Log key events (e.g. changes feed processing) as JSON objects.
 }
 
 // Init will initialize logging, return any warnings that need to be logged at a later time.
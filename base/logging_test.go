@@ -11,6 +11,7 @@ package base
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -54,6 +55,28 @@ func TestRedactedLogFuncs(t *testing.T) {
 	assertLogContains(t, "Username: <ud>alice</ud>", func() { Warnf("Username: %s", username) })
 }
 
+func TestLogEventCtx(t *testing.T) {
+	username := UD("alice")
+
+	defer func() {
+		JSONLogging = false
+		RedactUserData = false
+	}()
+
+	fields := map[string]interface{}{"user": username, "seq": 5}
+	logEvent := func() {
+		LogEventCtx(context.Background(), LevelInfo, KeyAll, "wait", fields, "Waiting - user: %s", username)
+	}
+
+	JSONLogging = false
+	assertLogContains(t, "Waiting - user: alice", logEvent)
+
+	JSONLogging = true
+	assertLogContains(t, `{"event":"wait","seq":5,"user":"alice"}`, logEvent)
+	RedactUserData = true
+	assertLogContains(t, `{"event":"wait","seq":5,"user":"<ud>alice</ud>"}`, logEvent)
+}
+
 func Benchmark_LoggingPerformance(b *testing.B) {
 
 	defer SetUpBenchmarkLogging(LevelInfo, KeyHTTP, KeyCRUD)()
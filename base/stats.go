@@ -2,11 +2,14 @@ package base
 
 import (
 	"expvar"
+	"fmt"
 	"math"
+	"math/bits"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -18,6 +21,7 @@ const (
 	ResourceUtilizationSubsystem = "resource_utilization"
 
 	SubsystemCacheKey           = "cache"
+	SubsystemChangesFeed        = "changes_feed"
 	SubsystemDatabaseKey        = "database"
 	SubsystemDeltaSyncKey       = "delta_sync"
 	SubsystemGSIViews           = "gsi_views"
@@ -151,6 +155,7 @@ type DbStats struct {
 	CacheStats              *CacheStats                   `json:"cache,omitempty"`
 	CBLReplicationPullStats *CBLReplicationPullStats      `json:"cbl_replication_pull,omitempty"`
 	CBLReplicationPushStats *CBLReplicationPushStats      `json:"cbl_replication_push,omitempty"`
+	ChangesFeedStats        *ChangesFeedStats             `json:"changes_feed,omitempty"`
 	DatabaseStats           *DatabaseStats                `json:"database,omitempty"`
 	DeltaSyncStats          *DeltaSyncStats               `json:"delta_sync,omitempty"`
 	QueryStats              *QueryStats                   `json:"gsi_views,omitempty"`
@@ -187,61 +192,97 @@ type CacheStats struct {
 }
 
 type CBLReplicationPullStats struct {
-	AttachmentPullBytes         *SgwIntStat `json:"attachment_pull_bytes"`
-	AttachmentPullCount         *SgwIntStat `json:"attachment_pull_count"`
-	MaxPending                  *SgwIntStat `json:"max_pending"`
-	NumReplicationsActive       *SgwIntStat `json:"num_replications_active"`
-	NumPullReplActiveContinuous *SgwIntStat `json:"num_pull_repl_active_continuous"`
-	NumPullReplActiveOneShot    *SgwIntStat `json:"num_pull_repl_active_one_shot"`
-	NumPullReplCaughtUp         *SgwIntStat `json:"num_pull_repl_caught_up"`
-	NumPullReplSinceZero        *SgwIntStat `json:"num_pull_repl_since_zero"`
-	NumPullReplTotalContinuous  *SgwIntStat `json:"num_pull_repl_total_continuous"`
-	NumPullReplTotalOneShot     *SgwIntStat `json:"num_pull_repl_total_one_shot"`
-	RequestChangesCount         *SgwIntStat `json:"request_changes_count"`
-	RequestChangesTime          *SgwIntStat `json:"request_changes_time"`
-	RevProcessingTime           *SgwIntStat `json:"rev_processing_time"`
-	RevSendCount                *SgwIntStat `json:"rev_send_count"`
-	RevSendLatency              *SgwIntStat `json:"rev_send_latency"`
+	AttachmentPullBytes             *SgwIntStat           `json:"attachment_pull_bytes"`
+	AttachmentPullBytesRate         *SgwFloatStat         `json:"attachment_pull_bytes_rate"`
+	AttachmentPullCount             *SgwIntStat           `json:"attachment_pull_count"`
+	AttachmentPullMaxConcurrent     *SgwIntStat           `json:"attachment_pull_max_concurrent"`
+	AttachmentPullThrottledCount    *SgwIntStat           `json:"attachment_pull_throttled_count"`
+	AttachmentPullThrottledRejected *SgwIntStat           `json:"attachment_pull_throttled_rejected"`
+	MaxPending                      *SgwIntStat           `json:"max_pending"`
+	NumReplicationsActive           *SgwIntStat           `json:"num_replications_active"`
+	NumPullReplActiveContinuous     *SgwIntStat           `json:"num_pull_repl_active_continuous"`
+	NumPullReplActiveOneShot        *SgwIntStat           `json:"num_pull_repl_active_one_shot"`
+	NumPullReplCaughtUp             *SgwIntStat           `json:"num_pull_repl_caught_up"`
+	NumPullReplSinceZero            *SgwIntStat           `json:"num_pull_repl_since_zero"`
+	NumPullReplTotalContinuous      *SgwIntStat           `json:"num_pull_repl_total_continuous"`
+	NumPullReplTotalOneShot         *SgwIntStat           `json:"num_pull_repl_total_one_shot"`
+	RequestChangesCount             *SgwIntStat           `json:"request_changes_count"`
+	RequestChangesTime              *SgwIntStat           `json:"request_changes_time"`
+	RevProcessingTime               *SgwIntStat           `json:"rev_processing_time"`
+	RevSendCount                    *SgwIntStat           `json:"rev_send_count"`
+	RevSendLatency                  *SgwIntStat           `json:"rev_send_latency"`
+	RevSendLatencyDistribution      *SgwDurationHistogram `json:"rev_send_latency_distribution"`
 }
 
 type CBLReplicationPushStats struct {
-	AttachmentPushBytes *SgwIntStat `json:"attachment_push_bytes"`
-	AttachmentPushCount *SgwIntStat `json:"attachment_push_count"`
-	DocPushCount        *SgwIntStat `json:"doc_push_count"`
-	ProposeChangeCount  *SgwIntStat `json:"propose_change_count"`
-	ProposeChangeTime   *SgwIntStat `json:"propose_change_time"`
-	SyncFunctionCount   *SgwIntStat `json:"sync_function_count"`
-	SyncFunctionTime    *SgwIntStat `json:"sync_function_time"`
-	WriteProcessingTime *SgwIntStat `json:"write_processing_time"`
+	AttachmentPushBytes             *SgwIntStat            `json:"attachment_push_bytes"`
+	AttachmentPushCount             *SgwIntStat            `json:"attachment_push_count"`
+	AttachmentPushLargest           *AttachmentTransferLog `json:"attachment_push_largest,omitempty"` // Only set when enabled with InitAttachmentTransferLog
+	DocPushCount                    *SgwIntStat            `json:"doc_push_count"`
+	ProposeChangeCount              *SgwIntStat            `json:"propose_change_count"`
+	ProposeChangeTime               *SgwIntStat            `json:"propose_change_time"`
+	SyncFunctionCount               *SgwIntStat            `json:"sync_function_count"`
+	SyncFunctionTime                *SgwIntStat            `json:"sync_function_time"`
+	WriteProcessingTime             *SgwIntStat            `json:"write_processing_time"`
+	WriteProcessingTimeDistribution *SgwDurationHistogram  `json:"write_processing_time_distribution"`
+}
+
+type ChangesFeedStats struct {
+	BackfillInProgressCount *SgwIntStat `json:"backfill_in_progress_count"`
+	BackfillNewCount        *SgwIntStat `json:"backfill_new_count"`
+	BackfillNoneCount       *SgwIntStat `json:"backfill_none_count"`
+	ConflictedEntriesCount  *SgwIntStat `json:"conflicted_entries_count"`
+	ExpandedChannelsCount   *SgwIntStat `json:"expanded_channels_count"`
+	ExpandedChannelsMax     *SgwIntStat `json:"expanded_channels_max"`
+	FeedGoroutinesMax       *SgwIntStat `json:"feed_goroutines_max"`
+	FirstEntryCount         *SgwIntStat `json:"first_entry_count"`
+	FirstEntryTime          *SgwIntStat `json:"first_entry_time"`
+	GzipBytes               *SgwIntStat `json:"gzip_bytes"`
+	GzipBytesUncompressed   *SgwIntStat `json:"gzip_bytes_uncompressed"`
+	IdleFeedsReclaimed      *SgwIntStat `json:"idle_feeds_reclaimed"`
+	LimitTruncatedEntries   *SgwIntStat `json:"limit_truncated_entries"`
+	LimitTruncatedFeeds     *SgwIntStat `json:"limit_truncated_feeds"`
+	MaxConcurrentFeeds      *SgwIntStat `json:"max_concurrent_feeds"`
+	NumActiveFeedGoroutines *SgwIntStat `json:"num_active_feed_goroutines"`
+	NumActiveFeeds          *SgwIntStat `json:"num_active_feeds"`
+	NumFeedsInBackfill      *SgwIntStat `json:"num_feeds_in_backfill"`
+	NumFeedsRejected        *SgwIntStat `json:"num_feeds_rejected"`
+	NumProductiveWakeups    *SgwIntStat `json:"num_productive_wakeups"`
+	NumSkippedWakeups       *SgwIntStat `json:"num_skipped_wakeups"`
+	NumWakeups              *SgwIntStat `json:"num_wakeups"`
+	RemovedChannelsMax      *SgwIntStat `json:"removed_channels_max"`
+	SendBlockedTime         *SgwIntStat `json:"send_blocked_time"`
 }
 
 type DatabaseStats struct {
-	AbandonedSeqs           *SgwIntStat `json:"abandoned_seqs"`
-	ConflictWriteCount      *SgwIntStat `json:"conflict_write_count"`
-	Crc32MatchCount         *SgwIntStat `json:"crc32c_match_count"`
-	DCPCachingCount         *SgwIntStat `json:"dcp_caching_count"`
-	DCPCachingTime          *SgwIntStat `json:"dcp_caching_time"`
-	DCPReceivedCount        *SgwIntStat `json:"dcp_received_count"`
-	DCPReceivedTime         *SgwIntStat `json:"dcp_received_time"`
-	DocReadsBytesBlip       *SgwIntStat `json:"doc_reads_bytes_blip"`
-	DocWritesBytes          *SgwIntStat `json:"doc_writes_bytes"`
-	DocWritesBytesBlip      *SgwIntStat `json:"doc_writes_bytes_blip"`
-	DocWritesXattrBytes     *SgwIntStat `json:"doc_writes_xattr_bytes"`
-	HighSeqFeed             *SgwIntStat `json:"high_seq_feed"`
-	NumDocReadsBlip         *SgwIntStat `json:"num_doc_reads_blip"`
-	NumDocReadsRest         *SgwIntStat `json:"num_doc_reads_rest"`
-	NumDocWrites            *SgwIntStat `json:"num_doc_writes"`
-	NumReplicationsActive   *SgwIntStat `json:"num_replications_active"`
-	NumReplicationsTotal    *SgwIntStat `json:"num_replications_total"`
-	NumTombstonesCompacted  *SgwIntStat `json:"num_tombstones_compacted"`
-	SequenceAssignedCount   *SgwIntStat `json:"sequence_assigned_count"`
-	SequenceGetCount        *SgwIntStat `json:"sequence_get_count"`
-	SequenceIncrCount       *SgwIntStat `json:"sequence_incr_count"`
-	SequenceReleasedCount   *SgwIntStat `json:"sequence_released_count"`
-	SequenceReservedCount   *SgwIntStat `json:"sequence_reserved_count"`
-	WarnChannelsPerDocCount *SgwIntStat `json:"warn_channels_per_doc_count"`
-	WarnGrantsPerDocCount   *SgwIntStat `json:"warn_grants_per_doc_count"`
-	WarnXattrSizeCount      *SgwIntStat `json:"warn_xattr_size_count"`
+	AbandonedSeqs                  *SgwIntStat `json:"abandoned_seqs"`
+	ConflictWriteCount             *SgwIntStat `json:"conflict_write_count"`
+	Crc32MatchCount                *SgwIntStat `json:"crc32c_match_count"`
+	DCPCachingCount                *SgwIntStat `json:"dcp_caching_count"`
+	DCPCachingTime                 *SgwIntStat `json:"dcp_caching_time"`
+	DCPReceivedCount               *SgwIntStat `json:"dcp_received_count"`
+	DCPReceivedTime                *SgwIntStat `json:"dcp_received_time"`
+	DocReadsBytesBlip              *SgwIntStat `json:"doc_reads_bytes_blip"`
+	DocReadsBytesBlipUncompressed  *SgwIntStat `json:"doc_reads_bytes_blip_uncompressed"`
+	DocWritesBytes                 *SgwIntStat `json:"doc_writes_bytes"`
+	DocWritesBytesBlip             *SgwIntStat `json:"doc_writes_bytes_blip"`
+	DocWritesBytesBlipUncompressed *SgwIntStat `json:"doc_writes_bytes_blip_uncompressed"`
+	DocWritesXattrBytes            *SgwIntStat `json:"doc_writes_xattr_bytes"`
+	HighSeqFeed                    *SgwIntStat `json:"high_seq_feed"`
+	NumDocReadsBlip                *SgwIntStat `json:"num_doc_reads_blip"`
+	NumDocReadsRest                *SgwIntStat `json:"num_doc_reads_rest"`
+	NumDocWrites                   *SgwIntStat `json:"num_doc_writes"`
+	NumReplicationsActive          *SgwIntStat `json:"num_replications_active"`
+	NumReplicationsTotal           *SgwIntStat `json:"num_replications_total"`
+	NumTombstonesCompacted         *SgwIntStat `json:"num_tombstones_compacted"`
+	SequenceAssignedCount          *SgwIntStat `json:"sequence_assigned_count"`
+	SequenceGetCount               *SgwIntStat `json:"sequence_get_count"`
+	SequenceIncrCount              *SgwIntStat `json:"sequence_incr_count"`
+	SequenceReleasedCount          *SgwIntStat `json:"sequence_released_count"`
+	SequenceReservedCount          *SgwIntStat `json:"sequence_reserved_count"`
+	WarnChannelsPerDocCount        *SgwIntStat `json:"warn_channels_per_doc_count"`
+	WarnGrantsPerDocCount          *SgwIntStat `json:"warn_grants_per_doc_count"`
+	WarnXattrSizeCount             *SgwIntStat `json:"warn_xattr_size_count"`
 
 	// These can be cleaned up in future versions of SGW, implemented as maps to reduce amount of potential risk
 	// prior to Hydrogen release. These are not exported as part of prometheus and only exposed through expvars
@@ -346,6 +387,11 @@ type DbReplicatorStats struct {
 	ConflictResolvedLocalCount  *SgwIntStat `json:"sgr_conflict_resolved_local_count"`
 	ConflictResolvedRemoteCount *SgwIntStat `json:"sgr_conflict_resolved_remote_count"`
 	ConflictResolvedMergedCount *SgwIntStat `json:"sgr_conflict_resolved_merge_count"`
+
+	ReplicationHealth *SgwIntStat `json:"sgr_replication_health"`
+
+	PushRevLatencyDistribution *SgwDurationHistogram `json:"sgr_push_rev_send_latency_distribution"`
+	PullRevTimeDistribution    *SgwDurationHistogram `json:"sgr_pull_rev_processing_time_distribution"`
 }
 
 type SecurityStats struct {
@@ -421,11 +467,14 @@ func (s *SgwIntStat) Set(newV int64) {
 	atomic.StoreInt64(&s.Val, newV)
 }
 
+// Sets the stat to newV if it's larger than the current value.
 func (s *SgwIntStat) SetIfMax(newV int64) {
 	for {
 		cur := atomic.LoadInt64(&s.Val)
-		nxtVal := cur + newV
-		if atomic.CompareAndSwapInt64(&s.Val, cur, nxtVal) {
+		if cur >= newV {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&s.Val, cur, newV) {
 			return
 		}
 	}
@@ -468,13 +517,14 @@ func (s *SgwFloatStat) Set(newV float64) {
 	atomic.StoreUint64(&s.Val, math.Float64bits(newV))
 }
 
+// Sets the stat to newV if it's larger than the current value.
 func (s *SgwFloatStat) SetIfMax(newV float64) {
 	for {
 		cur := atomic.LoadUint64(&s.Val)
-		curVal := math.Float64frombits(cur)
-		nxtVal := curVal + newV
-		nxt := math.Float64bits(nxtVal)
-		if atomic.CompareAndSwapUint64(&s.Val, cur, nxt) {
+		if math.Float64frombits(cur) >= newV {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&s.Val, cur, math.Float64bits(newV)) {
 			return
 		}
 	}
@@ -504,6 +554,102 @@ func (s *SgwFloatStat) Value() float64 {
 	return math.Float64frombits(atomic.LoadUint64(&s.Val))
 }
 
+// Number of buckets in an SgwDurationHistogram.  The last bucket holds all durations of 2^(n-2) microseconds (~18m)
+// or more.
+const durationHistogramBuckets = 32
+
+// SgwDurationHistogram tracks the distribution of durations in exponentially sized buckets (bucket i holds durations
+// of less than 2^i microseconds), so that percentiles can be estimated in bounded memory.  Percentiles are reported
+// as the upper bound of the bucket containing them, so are accurate to within a factor of two.  Exposed to
+// Prometheus as a summary, in nanoseconds.
+type SgwDurationHistogram struct {
+	SgwStat
+	counts [durationHistogramBuckets]uint64
+	sum    int64 // Total of recorded durations, in nanoseconds
+}
+
+func NewDurationHistogram(subsystem string, key string, labelKeys []string, labelVals []string) *SgwDurationHistogram {
+	stat := &SgwDurationHistogram{
+		SgwStat: *newSGWStat(subsystem, key, labelKeys, labelVals, prometheus.UntypedValue),
+	}
+	prometheus.MustRegister(stat)
+	return stat
+}
+
+func (h *SgwDurationHistogram) Describe(ch chan<- *prometheus.Desc) {
+	return
+}
+
+func (h *SgwDurationHistogram) Collect(ch chan<- prometheus.Metric) {
+	quantiles := map[float64]float64{
+		0.5:  float64(h.Percentile(0.5)),
+		0.95: float64(h.Percentile(0.95)),
+		0.99: float64(h.Percentile(0.99)),
+	}
+	ch <- prometheus.MustNewConstSummary(h.statDesc, h.Count(), float64(atomic.LoadInt64(&h.sum)), quantiles, h.labelValues...)
+}
+
+func (h *SgwDurationHistogram) Record(d time.Duration) {
+	bucket := 0
+	if micros := int64(d / time.Microsecond); micros > 0 {
+		bucket = MinInt(bits.Len64(uint64(micros)), durationHistogramBuckets-1)
+	}
+	atomic.AddUint64(&h.counts[bucket], 1)
+	atomic.AddInt64(&h.sum, d.Nanoseconds())
+}
+
+// Returns the estimated duration below which the given fraction (0-1) of recorded durations fall, or zero when
+// nothing has been recorded.
+func (h *SgwDurationHistogram) Percentile(fraction float64) time.Duration {
+	var counts [durationHistogramBuckets]uint64
+	var total uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(fraction * float64(total)))
+	if target == 0 {
+		target = 1
+	}
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		if cumulative >= target {
+			return time.Duration(uint64(1)<<uint(i)) * time.Microsecond
+		}
+	}
+	return time.Duration(uint64(1)<<uint(durationHistogramBuckets-1)) * time.Microsecond
+}
+
+// Returns the number of recorded durations
+func (h *SgwDurationHistogram) Count() uint64 {
+	var total uint64
+	for i := range h.counts {
+		total += atomic.LoadUint64(&h.counts[i])
+	}
+	return total
+}
+
+// Discards all recorded durations
+func (h *SgwDurationHistogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+}
+
+func (h *SgwDurationHistogram) MarshalJSON() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *SgwDurationHistogram) String() string {
+	return fmt.Sprintf(`{"count":%d,"p50":%d,"p95":%d,"p99":%d}`, h.Count(), h.Percentile(0.5), h.Percentile(0.95), h.Percentile(0.99))
+}
+
 type QueryStat struct {
 	QueryCount      *SgwIntStat
 	QueryErrorCount *SgwIntStat
@@ -521,6 +667,7 @@ func (s *SgwStats) NewDBStats(name string) *DbStats {
 	s.DbStats[name].initCacheStats()
 	s.DbStats[name].initCBLReplicationPullStats()
 	s.DbStats[name].initCBLReplicationPushStats()
+	s.DbStats[name].initChangesFeedStats()
 	s.DbStats[name].initDatabaseStats()
 	s.DbStats[name].initSecurityStats()
 
@@ -572,21 +719,26 @@ func (d *DbStats) initCBLReplicationPullStats() {
 	labelKeys := []string{DatabaseLabelKey}
 	labelVals := []string{d.dbName}
 	d.CBLReplicationPullStats = &CBLReplicationPullStats{
-		AttachmentPullBytes:         NewIntStat(SubsystemReplicationPull, "attachment_pull_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		AttachmentPullCount:         NewIntStat(SubsystemReplicationPull, "attachment_pull_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		MaxPending:                  NewIntStat(SubsystemReplicationPull, "max_pending", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumReplicationsActive:       NewIntStat(SubsystemReplicationPull, "num_pull_repl_active_continuous", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumPullReplActiveContinuous: NewIntStat(SubsystemReplicationPull, "num_pull_repl_active_one_shot", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumPullReplActiveOneShot:    NewIntStat(SubsystemReplicationPull, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumPullReplCaughtUp:         NewIntStat(SubsystemReplicationPull, "num_pull_repl_caught_up", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumPullReplSinceZero:        NewIntStat(SubsystemReplicationPull, "num_pull_repl_since_zero", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumPullReplTotalContinuous:  NewIntStat(SubsystemReplicationPull, "num_pull_repl_total_continuous", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumPullReplTotalOneShot:     NewIntStat(SubsystemReplicationPull, "num_pull_repl_total_one_shot", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		RequestChangesCount:         NewIntStat(SubsystemReplicationPull, "request_changes_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		RequestChangesTime:          NewIntStat(SubsystemReplicationPull, "request_changes_time", labelKeys, labelVals, prometheus.CounterValue, 0),
-		RevProcessingTime:           NewIntStat(SubsystemReplicationPull, "rev_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		RevSendCount:                NewIntStat(SubsystemReplicationPull, "rev_send_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		RevSendLatency:              NewIntStat(SubsystemReplicationPull, "rev_send_latency", labelKeys, labelVals, prometheus.CounterValue, 0),
+		AttachmentPullBytes:             NewIntStat(SubsystemReplicationPull, "attachment_pull_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		AttachmentPullBytesRate:         NewFloatStat(SubsystemReplicationPull, "attachment_pull_bytes_rate", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		AttachmentPullCount:             NewIntStat(SubsystemReplicationPull, "attachment_pull_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		AttachmentPullMaxConcurrent:     NewIntStat(SubsystemReplicationPull, "attachment_pull_max_concurrent", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		AttachmentPullThrottledCount:    NewIntStat(SubsystemReplicationPull, "attachment_pull_throttled_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		AttachmentPullThrottledRejected: NewIntStat(SubsystemReplicationPull, "attachment_pull_throttled_rejected", labelKeys, labelVals, prometheus.CounterValue, 0),
+		MaxPending:                      NewIntStat(SubsystemReplicationPull, "max_pending", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumReplicationsActive:           NewIntStat(SubsystemReplicationPull, "num_pull_repl_active_continuous", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumPullReplActiveContinuous:     NewIntStat(SubsystemReplicationPull, "num_pull_repl_active_one_shot", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumPullReplActiveOneShot:        NewIntStat(SubsystemReplicationPull, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumPullReplCaughtUp:             NewIntStat(SubsystemReplicationPull, "num_pull_repl_caught_up", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumPullReplSinceZero:            NewIntStat(SubsystemReplicationPull, "num_pull_repl_since_zero", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumPullReplTotalContinuous:      NewIntStat(SubsystemReplicationPull, "num_pull_repl_total_continuous", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumPullReplTotalOneShot:         NewIntStat(SubsystemReplicationPull, "num_pull_repl_total_one_shot", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		RequestChangesCount:             NewIntStat(SubsystemReplicationPull, "request_changes_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RequestChangesTime:              NewIntStat(SubsystemReplicationPull, "request_changes_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RevProcessingTime:               NewIntStat(SubsystemReplicationPull, "rev_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		RevSendCount:                    NewIntStat(SubsystemReplicationPull, "rev_send_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RevSendLatency:                  NewIntStat(SubsystemReplicationPull, "rev_send_latency", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RevSendLatencyDistribution:      NewDurationHistogram(SubsystemReplicationPull, "rev_send_latency_distribution", labelKeys, labelVals),
 	}
 }
 
@@ -598,14 +750,15 @@ func (d *DbStats) initCBLReplicationPushStats() {
 	labelKeys := []string{DatabaseLabelKey}
 	labelVals := []string{d.dbName}
 	d.CBLReplicationPushStats = &CBLReplicationPushStats{
-		AttachmentPushBytes: NewIntStat(SubsystemReplicationPush, "attachment_push_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		AttachmentPushCount: NewIntStat(SubsystemReplicationPush, "attachment_push_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocPushCount:        NewIntStat(SubsystemReplicationPush, "doc_push_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		ProposeChangeCount:  NewIntStat(SubsystemReplicationPush, "propose_change_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		ProposeChangeTime:   NewIntStat(SubsystemReplicationPush, "propose_change_time", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SyncFunctionCount:   NewIntStat(SubsystemReplicationPush, "sync_function_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SyncFunctionTime:    NewIntStat(SubsystemReplicationPush, "sync_function_time", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WriteProcessingTime: NewIntStat(SubsystemReplicationPush, "write_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		AttachmentPushBytes:             NewIntStat(SubsystemReplicationPush, "attachment_push_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		AttachmentPushCount:             NewIntStat(SubsystemReplicationPush, "attachment_push_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocPushCount:                    NewIntStat(SubsystemReplicationPush, "doc_push_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ProposeChangeCount:              NewIntStat(SubsystemReplicationPush, "propose_change_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ProposeChangeTime:               NewIntStat(SubsystemReplicationPush, "propose_change_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionCount:               NewIntStat(SubsystemReplicationPush, "sync_function_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionTime:                NewIntStat(SubsystemReplicationPush, "sync_function_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WriteProcessingTime:             NewIntStat(SubsystemReplicationPush, "write_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		WriteProcessingTimeDistribution: NewDurationHistogram(SubsystemReplicationPush, "write_processing_time_distribution", labelKeys, labelVals),
 	}
 }
 
@@ -613,38 +766,75 @@ func (d *DbStats) CBLReplicationPush() *CBLReplicationPushStats {
 	return d.CBLReplicationPushStats
 }
 
+func (d *DbStats) initChangesFeedStats() {
+	labelKeys := []string{DatabaseLabelKey}
+	labelVals := []string{d.dbName}
+	d.ChangesFeedStats = &ChangesFeedStats{
+		BackfillInProgressCount: NewIntStat(SubsystemChangesFeed, "backfill_in_progress_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		BackfillNewCount:        NewIntStat(SubsystemChangesFeed, "backfill_new_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		BackfillNoneCount:       NewIntStat(SubsystemChangesFeed, "backfill_none_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ConflictedEntriesCount:  NewIntStat(SubsystemChangesFeed, "conflicted_entries_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ExpandedChannelsCount:   NewIntStat(SubsystemChangesFeed, "expanded_channels_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ExpandedChannelsMax:     NewIntStat(SubsystemChangesFeed, "expanded_channels_max", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		FeedGoroutinesMax:       NewIntStat(SubsystemChangesFeed, "feed_goroutines_max", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		FirstEntryCount:         NewIntStat(SubsystemChangesFeed, "first_entry_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		FirstEntryTime:          NewIntStat(SubsystemChangesFeed, "first_entry_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		GzipBytes:               NewIntStat(SubsystemChangesFeed, "gzip_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		GzipBytesUncompressed:   NewIntStat(SubsystemChangesFeed, "gzip_bytes_uncompressed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		IdleFeedsReclaimed:      NewIntStat(SubsystemChangesFeed, "idle_feeds_reclaimed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		LimitTruncatedEntries:   NewIntStat(SubsystemChangesFeed, "limit_truncated_entries", labelKeys, labelVals, prometheus.CounterValue, 0),
+		LimitTruncatedFeeds:     NewIntStat(SubsystemChangesFeed, "limit_truncated_feeds", labelKeys, labelVals, prometheus.CounterValue, 0),
+		MaxConcurrentFeeds:      NewIntStat(SubsystemChangesFeed, "max_concurrent_feeds", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumActiveFeedGoroutines: NewIntStat(SubsystemChangesFeed, "num_active_feed_goroutines", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumActiveFeeds:          NewIntStat(SubsystemChangesFeed, "num_active_feeds", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumFeedsInBackfill:      NewIntStat(SubsystemChangesFeed, "num_feeds_in_backfill", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumFeedsRejected:        NewIntStat(SubsystemChangesFeed, "num_feeds_rejected", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumProductiveWakeups:    NewIntStat(SubsystemChangesFeed, "num_productive_wakeups", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumSkippedWakeups:       NewIntStat(SubsystemChangesFeed, "num_skipped_wakeups", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumWakeups:              NewIntStat(SubsystemChangesFeed, "num_wakeups", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RemovedChannelsMax:      NewIntStat(SubsystemChangesFeed, "removed_channels_max", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		SendBlockedTime:         NewIntStat(SubsystemChangesFeed, "send_blocked_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+	}
+}
+
+func (d *DbStats) ChangesFeed() *ChangesFeedStats {
+	return d.ChangesFeedStats
+}
+
 func (d *DbStats) initDatabaseStats() {
 	labelKeys := []string{DatabaseLabelKey}
 	labelVals := []string{d.dbName}
 	d.DatabaseStats = &DatabaseStats{
-		AbandonedSeqs:           NewIntStat(SubsystemDatabaseKey, "abandoned_seqs", labelKeys, labelVals, prometheus.CounterValue, 0),
-		ConflictWriteCount:      NewIntStat(SubsystemDatabaseKey, "conflict_write_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		Crc32MatchCount:         NewIntStat(SubsystemDatabaseKey, "crc32c_match_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPCachingCount:         NewIntStat(SubsystemDatabaseKey, "dcp_caching_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPCachingTime:          NewIntStat(SubsystemDatabaseKey, "dcp_caching_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPReceivedCount:        NewIntStat(SubsystemDatabaseKey, "dcp_received_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPReceivedTime:         NewIntStat(SubsystemDatabaseKey, "dcp_received_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DocReadsBytesBlip:       NewIntStat(SubsystemDatabaseKey, "doc_reads_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesBytes:          NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesXattrBytes:     NewIntStat(SubsystemDatabaseKey, "doc_writes_xattr_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		HighSeqFeed:             NewIntStat(SubsystemDatabaseKey, "high_seq_feed", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesBytesBlip:      NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocReadsBlip:         NewIntStat(SubsystemDatabaseKey, "num_doc_reads_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocReadsRest:         NewIntStat(SubsystemDatabaseKey, "num_doc_reads_rest", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocWrites:            NewIntStat(SubsystemDatabaseKey, "num_doc_writes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumReplicationsActive:   NewIntStat(SubsystemDatabaseKey, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumReplicationsTotal:    NewIntStat(SubsystemDatabaseKey, "num_replications_total", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumTombstonesCompacted:  NewIntStat(SubsystemDatabaseKey, "num_tombstones_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceAssignedCount:   NewIntStat(SubsystemDatabaseKey, "sequence_assigned_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceGetCount:        NewIntStat(SubsystemDatabaseKey, "sequence_get_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceIncrCount:       NewIntStat(SubsystemDatabaseKey, "sequence_incr_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceReleasedCount:   NewIntStat(SubsystemDatabaseKey, "sequence_released_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceReservedCount:   NewIntStat(SubsystemDatabaseKey, "sequence_reserved_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnChannelsPerDocCount: NewIntStat(SubsystemDatabaseKey, "warn_channels_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnGrantsPerDocCount:   NewIntStat(SubsystemDatabaseKey, "warn_grants_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnXattrSizeCount:      NewIntStat(SubsystemDatabaseKey, "warn_xattr_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		ImportFeedMapStats:      &ExpVarMapWrapper{new(expvar.Map).Init()},
-		CacheFeedMapStats:       &ExpVarMapWrapper{new(expvar.Map).Init()},
+		AbandonedSeqs:                  NewIntStat(SubsystemDatabaseKey, "abandoned_seqs", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ConflictWriteCount:             NewIntStat(SubsystemDatabaseKey, "conflict_write_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		Crc32MatchCount:                NewIntStat(SubsystemDatabaseKey, "crc32c_match_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPCachingCount:                NewIntStat(SubsystemDatabaseKey, "dcp_caching_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPCachingTime:                 NewIntStat(SubsystemDatabaseKey, "dcp_caching_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPReceivedCount:               NewIntStat(SubsystemDatabaseKey, "dcp_received_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPReceivedTime:                NewIntStat(SubsystemDatabaseKey, "dcp_received_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DocReadsBytesBlip:              NewIntStat(SubsystemDatabaseKey, "doc_reads_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocReadsBytesBlipUncompressed:  NewIntStat(SubsystemDatabaseKey, "doc_reads_bytes_blip_uncompressed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytes:                 NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesXattrBytes:            NewIntStat(SubsystemDatabaseKey, "doc_writes_xattr_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		HighSeqFeed:                    NewIntStat(SubsystemDatabaseKey, "high_seq_feed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytesBlip:             NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytesBlipUncompressed: NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes_blip_uncompressed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocReadsBlip:                NewIntStat(SubsystemDatabaseKey, "num_doc_reads_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocReadsRest:                NewIntStat(SubsystemDatabaseKey, "num_doc_reads_rest", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocWrites:                   NewIntStat(SubsystemDatabaseKey, "num_doc_writes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumReplicationsActive:          NewIntStat(SubsystemDatabaseKey, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumReplicationsTotal:           NewIntStat(SubsystemDatabaseKey, "num_replications_total", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumTombstonesCompacted:         NewIntStat(SubsystemDatabaseKey, "num_tombstones_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceAssignedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_assigned_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceGetCount:               NewIntStat(SubsystemDatabaseKey, "sequence_get_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceIncrCount:              NewIntStat(SubsystemDatabaseKey, "sequence_incr_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceReleasedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_released_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceReservedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_reserved_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnChannelsPerDocCount:        NewIntStat(SubsystemDatabaseKey, "warn_channels_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnGrantsPerDocCount:          NewIntStat(SubsystemDatabaseKey, "warn_grants_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnXattrSizeCount:             NewIntStat(SubsystemDatabaseKey, "warn_xattr_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ImportFeedMapStats:             &ExpVarMapWrapper{new(expvar.Map).Init()},
+		CacheFeedMapStats:              &ExpVarMapWrapper{new(expvar.Map).Init()},
 	}
 }
 
@@ -665,6 +855,11 @@ func (d *DbStats) InitDeltaSyncStats() {
 	}
 }
 
+// Enables recording of the largest size attachments pushed, with their doc IDs
+func (d *DbStats) InitAttachmentTransferLog(size int) {
+	d.CBLReplicationPush().AttachmentPushLargest = NewAttachmentTransferLog(size)
+}
+
 func (d *DbStats) DeltaSync() *DeltaSyncStats {
 	return d.DeltaSyncStats
 }
@@ -715,6 +910,9 @@ func (d *DbStats) DBReplicatorStats(replicationID string) *DbReplicatorStats {
 			ConflictResolvedMergedCount: NewIntStat(SubsystemReplication, "sgr_conflict_resolved_merge_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumConnectAttemptsPull:      NewIntStat(SubsystemReplication, "sgr_num_connect_attempts_pull", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumReconnectsAbortedPull:    NewIntStat(SubsystemReplication, "sgr_num_reconnects_aborted_pull", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ReplicationHealth:           NewIntStat(SubsystemReplication, "sgr_replication_health", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			PushRevLatencyDistribution:  NewDurationHistogram(SubsystemReplication, "sgr_push_rev_send_latency_distribution", labelKeys, labelVals),
+			PullRevTimeDistribution:     NewDurationHistogram(SubsystemReplication, "sgr_pull_rev_processing_time_distribution", labelKeys, labelVals),
 		}
 	}
 
@@ -742,6 +940,9 @@ func (dbr *DbReplicatorStats) Reset() {
 	dbr.ConflictResolvedLocalCount.Set(0)
 	dbr.ConflictResolvedRemoteCount.Set(0)
 	dbr.ConflictResolvedMergedCount.Set(0)
+	dbr.ReplicationHealth.Set(0)
+	dbr.PushRevLatencyDistribution.Reset()
+	dbr.PullRevTimeDistribution.Reset()
 }
 
 func (d *DbStats) Security() *SecurityStats {
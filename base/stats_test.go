@@ -3,6 +3,9 @@ package base
 import (
 	"expvar"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkExpvarString(b *testing.B) {
@@ -132,3 +135,44 @@ func initExpvarBaseEquivalent() *expvar.Map {
 
 	return expvarMap
 }
+
+func TestDurationHistogram(t *testing.T) {
+	histogram := &SgwDurationHistogram{}
+	assert.Equal(t, time.Duration(0), histogram.Percentile(0.5))
+
+	// 90 fast (~100µs) and 10 slow (~10ms) durations
+	for i := 0; i < 90; i++ {
+		histogram.Record(100 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		histogram.Record(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(100), histogram.Count())
+
+	// Percentiles are the upper bound of the containing power-of-two (microsecond) bucket
+	assert.Equal(t, 128*time.Microsecond, histogram.Percentile(0.5))
+	assert.Equal(t, 16384*time.Microsecond, histogram.Percentile(0.95))
+	assert.Equal(t, 16384*time.Microsecond, histogram.Percentile(0.99))
+
+	histogram.Reset()
+	assert.Equal(t, uint64(0), histogram.Count())
+	assert.Equal(t, time.Duration(0), histogram.Percentile(0.99))
+}
+
+func TestStatSetIfMax(t *testing.T) {
+	intStat := &SgwIntStat{}
+	intStat.SetIfMax(3)
+	assert.Equal(t, int64(3), intStat.Value())
+	intStat.SetIfMax(1)
+	assert.Equal(t, int64(3), intStat.Value())
+	intStat.SetIfMax(7)
+	assert.Equal(t, int64(7), intStat.Value())
+
+	floatStat := &SgwFloatStat{}
+	floatStat.SetIfMax(2.5)
+	assert.Equal(t, 2.5, floatStat.Value())
+	floatStat.SetIfMax(1.5)
+	assert.Equal(t, 2.5, floatStat.Value())
+	floatStat.SetIfMax(4)
+	assert.Equal(t, 4.0, floatStat.Value())
+}
@@ -33,6 +33,7 @@ type LogEntry struct {
 	Value        []byte       // Snapshot metadata (when Type=LogEntryCheckpoint)
 	PrevSequence uint64       // Sequence of previous active revision
 	IsPrincipal  bool         // Whether the log-entry is a tracking entry for a principal doc
+	Cas          uint64       // CAS of the doc revision, when known (not set by channel queries)
 }
 
 func (l LogEntry) String() string {
@@ -79,6 +79,9 @@ type ActiveReplicatorConfig struct {
 	// disabled during replication. TLS certificate verification is enabled by default.
 	InsecureSkipVerify bool
 
+	// HealthThresholds are used to derive the replication's health.  Unset thresholds use their defaults.
+	HealthThresholds ReplicationHealthThresholds
+
 	// Callback to be invoked on replication completion
 	onComplete OnCompleteFunc
 
@@ -206,5 +209,9 @@ func (arc *ActiveReplicatorConfig) Equals(other *ActiveReplicatorConfig) bool {
 		return false
 	}
 
+	if arc.HealthThresholds != other.HealthThresholds {
+		return false
+	}
+
 	return true
 }
@@ -37,6 +37,8 @@ func (apr *ActivePullReplicator) Start() error {
 	logCtx := context.WithValue(context.Background(), base.LogContextKey{}, base.LogContext{CorrelationID: apr.config.ID + "-" + string(ActiveReplicatorTypePull)})
 	apr.ctx, apr.ctxCancel = context.WithCancel(logCtx)
 
+	apr.startHealthMonitor(apr.ctx, ActiveReplicatorTypePull)
+
 	err := apr._connect()
 	if err != nil {
 		_ = apr.setError(err)
@@ -40,6 +40,8 @@ func (apr *ActivePushReplicator) Start() error {
 	logCtx := context.WithValue(context.Background(), base.LogContextKey{}, base.LogContext{CorrelationID: apr.config.ID + "-" + string(ActiveReplicatorTypePush)})
 	apr.ctx, apr.ctxCancel = context.WithCancel(logCtx)
 
+	apr.startHealthMonitor(apr.ctx, ActiveReplicatorTypePush)
+
 	err := apr._connect()
 	if err != nil {
 		_ = apr.setError(err)
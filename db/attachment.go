@@ -13,6 +13,7 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 )
@@ -172,6 +173,42 @@ func (db *Database) GetAttachment(key AttachmentKey) ([]byte, error) {
 	return v, err
 }
 
+// Reserves a slot for fetching an attachment for a BLIP client when MaxConcurrentAttachmentFetches is set.  When all
+// slots are in use, waits up to AttachmentFetchWait for a fetch to finish.  Returns whether a slot was reserved, and
+// whether the fetch had to wait for one.
+func (dbc *DatabaseContext) acquireAttachmentFetchSlot() (acquired bool, throttled bool) {
+	if dbc.attachmentFetchSlots == nil {
+		return true, false
+	}
+
+	select {
+	case dbc.attachmentFetchSlots <- struct{}{}:
+		return true, false
+	default:
+	}
+
+	wait := dbc.Options.AttachmentFetchWait
+	if wait <= 0 {
+		return false, true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case dbc.attachmentFetchSlots <- struct{}{}:
+		return true, true
+	case <-timer.C:
+		return false, true
+	}
+}
+
+// Releases a slot reserved by acquireAttachmentFetchSlot.
+func (dbc *DatabaseContext) releaseAttachmentFetchSlot() {
+	if dbc.attachmentFetchSlots == nil {
+		return
+	}
+	<-dbc.attachmentFetchSlots
+}
+
 // Stores a base64-encoded attachment and returns the key to get it by.
 func (db *Database) setAttachment(attachment []byte) (AttachmentKey, error) {
 	key := AttachmentKey(Sha1DigestKey(attachment))
@@ -18,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/channels"
@@ -1360,3 +1361,32 @@ func TestMigrateBodyAttachmentsMergeConflicting(t *testing.T) {
 	bodyAtts, foundBodyAtts := body1[BodyAttachments]
 	assert.False(t, foundBodyAtts, "not expecting '_attachments' in body but found them: %v", bodyAtts)
 }
+
+func TestAttachmentFetchSlots(t *testing.T) {
+	db := setupTestDBWithOptions(t, DatabaseContextOptions{
+		MaxConcurrentAttachmentFetches: 1,
+		AttachmentFetchWait:            10 * time.Millisecond,
+	})
+	defer db.Close()
+	assert.Equal(t, int64(1), db.DbStats.CBLReplicationPull().AttachmentPullMaxConcurrent.Value())
+
+	acquired, throttled := db.acquireAttachmentFetchSlot()
+	assert.True(t, acquired)
+	assert.False(t, throttled)
+
+	// The wait times out while the only slot is in use
+	acquired, throttled = db.acquireAttachmentFetchSlot()
+	assert.False(t, acquired)
+	assert.True(t, throttled)
+
+	// A waiting fetch gets the slot once it's released
+	go func() {
+		time.Sleep(time.Millisecond)
+		db.releaseAttachmentFetchSlot()
+	}()
+	db.Options.AttachmentFetchWait = 10 * time.Second
+	acquired, throttled = db.acquireAttachmentFetchSlot()
+	assert.True(t, acquired)
+	assert.True(t, throttled)
+	db.releaseAttachmentFetchSlot()
+}
@@ -611,7 +611,9 @@ type removalDocument struct {
 func (bh *blipHandler) handleRev(rq *blip.Message) (err error) {
 	startTime := time.Now()
 	defer func() {
-		bh.replicationStats.HandleRevProcessingTime.Add(time.Since(startTime).Nanoseconds())
+		processingTime := time.Since(startTime)
+		bh.replicationStats.HandleRevProcessingTime.Add(processingTime.Nanoseconds())
+		bh.replicationStats.HandleRevProcessingTimeDistribution.Record(processingTime)
 		if err == nil {
 			bh.BlipSyncContext.replicationStats.HandleRevCount.Add(1)
 		} else {
@@ -712,6 +714,13 @@ func (bh *blipHandler) handleRev(rq *blip.Message) (err error) {
 		newDoc.UpdateBody(deltaSrcMap)
 		base.TracefCtx(bh.loggingCtx, base.KeySync, "docID: %s - body after patching: %v", base.UD(docID), base.UD(deltaSrcMap))
 		bh.replicationStats.HandleRevDeltaRecvCount.Add(1)
+
+		// BodyBytes caches the marshalled body on the doc, so it's typically reused when the doc is written
+		if patchedBodyBytes, err := newDoc.BodyBytes(); err == nil {
+			bh.replicationStats.HandleRevBytesUncompressed.Add(int64(len(patchedBodyBytes)))
+		}
+	} else {
+		bh.replicationStats.HandleRevBytesUncompressed.Add(int64(len(bodyBytes)))
 	}
 
 	// Handle and pull out expiry
@@ -836,7 +845,17 @@ func (bh *blipHandler) handleGetAttachment(rq *blip.Message) error {
 	if !bh.isAttachmentAllowed(digest) {
 		return base.HTTPErrorf(http.StatusForbidden, "Attachment's doc not being synced")
 	}
+	acquired, throttled := bh.db.acquireAttachmentFetchSlot()
+	if throttled {
+		bh.replicationStats.HandleGetAttachmentThrottled.Add(1)
+	}
+	if !acquired {
+		bh.replicationStats.HandleGetAttachmentRejected.Add(1)
+		base.InfofCtx(bh.loggingCtx, base.KeySync, "Too many concurrent attachment fetches - rejecting request for digest=%q", digest)
+		return base.HTTPErrorf(http.StatusServiceUnavailable, "Too many concurrent attachment requests")
+	}
 	attachment, err := bh.db.GetAttachment(AttachmentKey(digest))
+	bh.db.releaseAttachmentFetchSlot()
 	if err != nil {
 		return err
 
@@ -856,6 +875,7 @@ var NoBLIPHandlerError = fmt.Errorf("404 - No handler for BLIP request")
 // sendGetAttachment requests the full attachment from the peer.
 func (bh *blipHandler) sendGetAttachment(sender *blip.Sender, docID string, name string, digest string, meta map[string]interface{}) ([]byte, error) {
 	base.DebugfCtx(bh.loggingCtx, base.KeySync, "    Asking for attachment %q for doc %s (digest %s)", base.UD(name), base.UD(docID), digest)
+	startTime := time.Now()
 	outrq := blip.NewRequest()
 	outrq.Properties = map[string]string{BlipProfile: MessageGetAttachment, GetAttachmentDigest: digest}
 	if isCompressible(name, meta) {
@@ -885,6 +905,12 @@ func (bh *blipHandler) sendGetAttachment(sender *blip.Sender, docID string, name
 
 	bh.replicationStats.GetAttachment.Add(1)
 	bh.replicationStats.GetAttachmentBytes.Add(metaLength)
+	bh.replicationStats.GetAttachmentLargest.Add(base.AttachmentTransfer{
+		DocID:    docID,
+		Digest:   digest,
+		Size:     metaLength,
+		Duration: time.Since(startTime),
+	})
 
 	return respBody, nil
 }
@@ -300,7 +300,9 @@ func (bsc *BlipSyncContext) handleChangesResponse(sender *blip.Sender, response
 				return err
 			}
 
-			revSendTimeLatency += time.Since(changesResponseReceived).Nanoseconds()
+			revSendLatency := time.Since(changesResponseReceived)
+			revSendTimeLatency += revSendLatency.Nanoseconds()
+			bsc.replicationStats.HandleChangesSendRevLatencyDistribution.Record(revSendLatency)
 			revSendCount++
 
 			if bsc.sgr2PushAddExpectedSeqsCallback != nil {
@@ -349,6 +351,10 @@ func (bsc *BlipSyncContext) sendRevisionWithProperties(sender *blip.Sender, docI
 	// Update read stats
 	if messageBody, err := outrq.Body(); err == nil {
 		bsc.replicationStats.SendRevBytes.Add(int64(len(messageBody)))
+		// Uncompressed size for deltas is tracked by sendDelta
+		if properties[RevMessageDeltaSrc] == "" {
+			bsc.replicationStats.SendRevBytesUncompressed.Add(int64(len(messageBody)))
+		}
 	}
 
 	base.TracefCtx(bsc.loggingCtx, base.KeySync, "Sending revision %s/%s, body:%s, properties: %v, attDigests: %v", base.UD(docID), revID, base.UD(string(bodyBytes)), base.UD(properties), attDigests)
@@ -478,6 +484,7 @@ func (bsc *BlipSyncContext) sendDelta(sender *blip.Sender, docID, deltaSrcRevID
 	properties[RevMessageDeltaSrc] = deltaSrcRevID
 
 	base.DebugfCtx(bsc.loggingCtx, base.KeySync, "Sending rev %q %s as delta. DeltaSrc:%s", base.UD(docID), revDelta.ToRevID, deltaSrcRevID)
+	bsc.replicationStats.SendRevBytesUncompressed.Add(int64(revDelta.ToBodySize))
 	return bsc.sendRevisionWithProperties(sender, docID, revDelta.ToRevID, revDelta.DeltaBytes, revDelta.AttachmentDigests, properties, seq, resendFullRevisionFunc)
 }
 
@@ -1,88 +1,118 @@
 package db
 
 import (
+	"context"
+	"time"
+
 	"github.com/couchbase/sync_gateway/base"
 )
 
+// Window over which attachment transfer rates are calculated, and the interval at which they're updated
+const (
+	attachmentRateWindow         = 10 * time.Second
+	attachmentRateUpdateInterval = time.Second
+)
+
 // Note: To have any of these appear in expvars they must be connected to a stat inside of stats.go - This is done via
-// the BlipSyncStatsForCBL, BlipSyncStatsForSGRPush and BlipSyncStatsForSGRPull functions.
+// the BlipSyncStatsForCBL, BlipSyncStatsForSGRPush, BlipSyncStatsForSGRPull and BlipSyncStatsForSGRBidirectional
+// functions.
 type BlipSyncStats struct {
-	DeltaEnabledPullReplicationCount *base.SgwIntStat // global
-	HandleRevCount                   *base.SgwIntStat // handleRev
-	HandleRevErrorCount              *base.SgwIntStat
-	HandleRevDeltaRecvCount          *base.SgwIntStat
-	HandleRevBytes                   *base.SgwIntStat
-	HandleRevProcessingTime          *base.SgwIntStat
-	HandleRevDocsPurgedCount         *base.SgwIntStat
-	SendRevCount                     *base.SgwIntStat // sendRev
-	SendRevDeltaRequestedCount       *base.SgwIntStat
-	SendRevDeltaSentCount            *base.SgwIntStat
-	SendRevBytes                     *base.SgwIntStat
-	SendRevErrorTotal                *base.SgwIntStat
-	SendRevErrorConflictCount        *base.SgwIntStat
-	SendRevErrorRejectedCount        *base.SgwIntStat
-	SendRevErrorOtherCount           *base.SgwIntStat
-	HandleChangesCount               *base.SgwIntStat // handleChanges/handleProposeChanges
-	HandleChangesTime                *base.SgwIntStat
-	HandleChangesDeltaRequestedCount *base.SgwIntStat
-	HandleProveAttachment            *base.SgwIntStat // handleProveAttachment
-	HandleGetAttachment              *base.SgwIntStat // handleGetAttachment
-	HandleGetAttachmentBytes         *base.SgwIntStat
-	ProveAttachment                  *base.SgwIntStat // sendProveAttachment
-	GetAttachment                    *base.SgwIntStat // sendGetAttachment
-	GetAttachmentBytes               *base.SgwIntStat
-	HandleChangesResponseCount       *base.SgwIntStat // handleChangesResponse
-	HandleChangesResponseTime        *base.SgwIntStat
-	HandleChangesSendRevCount        *base.SgwIntStat //  - (duplicates SendRevCount, included for support of CBL expvars)
-	HandleChangesSendRevLatency      *base.SgwIntStat
-	HandleChangesSendRevTime         *base.SgwIntStat
-	SubChangesContinuousActive       *base.SgwIntStat // subChanges
-	SubChangesContinuousTotal        *base.SgwIntStat
-	SubChangesOneShotActive          *base.SgwIntStat
-	SubChangesOneShotTotal           *base.SgwIntStat
-	SendChangesCount                 *base.SgwIntStat // sendChanges
-	NumConnectAttempts               *base.SgwIntStat
-	NumReconnectsAborted             *base.SgwIntStat
+	DeltaEnabledPullReplicationCount        *base.SgwIntStat // global
+	HandleRevCount                          *base.SgwIntStat // handleRev
+	HandleRevErrorCount                     *base.SgwIntStat
+	HandleRevDeltaRecvCount                 *base.SgwIntStat
+	HandleRevBytes                          *base.SgwIntStat
+	HandleRevBytesUncompressed              *base.SgwIntStat // HandleRevBytes, with deltas counted as the size of the patched body
+	HandleRevProcessingTime                 *base.SgwIntStat
+	HandleRevProcessingTimeDistribution     *base.SgwDurationHistogram
+	HandleRevDocsPurgedCount                *base.SgwIntStat
+	SendRevCount                            *base.SgwIntStat // sendRev
+	SendRevDeltaRequestedCount              *base.SgwIntStat
+	SendRevDeltaSentCount                   *base.SgwIntStat
+	SendRevBytes                            *base.SgwIntStat
+	SendRevBytesUncompressed                *base.SgwIntStat // SendRevBytes, with deltas counted as the size of the full body
+	SendRevErrorTotal                       *base.SgwIntStat
+	SendRevErrorConflictCount               *base.SgwIntStat
+	SendRevErrorRejectedCount               *base.SgwIntStat
+	SendRevErrorOtherCount                  *base.SgwIntStat
+	HandleChangesCount                      *base.SgwIntStat // handleChanges/handleProposeChanges
+	HandleChangesTime                       *base.SgwIntStat
+	HandleChangesDeltaRequestedCount        *base.SgwIntStat
+	HandleProveAttachment                   *base.SgwIntStat // handleProveAttachment
+	HandleGetAttachment                     *base.SgwIntStat // handleGetAttachment
+	HandleGetAttachmentBytes                *base.SgwIntStat
+	HandleGetAttachmentBytesRate            *base.SgwFloatStat // bytes/sec over attachmentRateWindow, see updateAttachmentRates
+	HandleGetAttachmentThrottled            *base.SgwIntStat   // Requests that waited for an attachment fetch slot, see DatabaseContextOptions.MaxConcurrentAttachmentFetches
+	HandleGetAttachmentRejected             *base.SgwIntStat   // Requests that timed out waiting for an attachment fetch slot
+	ProveAttachment                         *base.SgwIntStat   // sendProveAttachment
+	GetAttachment                           *base.SgwIntStat   // sendGetAttachment
+	GetAttachmentBytes                      *base.SgwIntStat
+	GetAttachmentBytesRate                  *base.SgwFloatStat          // bytes/sec over attachmentRateWindow, see updateAttachmentRates
+	GetAttachmentLargest                    *base.AttachmentTransferLog // nil unless DatabaseContextOptions.AttachmentTransferLogSize is set
+	HandleChangesResponseCount              *base.SgwIntStat            // handleChangesResponse
+	HandleChangesResponseTime               *base.SgwIntStat
+	HandleChangesSendRevCount               *base.SgwIntStat //  - (duplicates SendRevCount, included for support of CBL expvars)
+	HandleChangesSendRevLatency             *base.SgwIntStat
+	HandleChangesSendRevLatencyDistribution *base.SgwDurationHistogram
+	HandleChangesSendRevTime                *base.SgwIntStat
+	SubChangesContinuousActive              *base.SgwIntStat // subChanges
+	SubChangesContinuousTotal               *base.SgwIntStat
+	SubChangesOneShotActive                 *base.SgwIntStat
+	SubChangesOneShotTotal                  *base.SgwIntStat
+	SendChangesCount                        *base.SgwIntStat // sendChanges
+	NumConnectAttempts                      *base.SgwIntStat
+	NumReconnectsAborted                    *base.SgwIntStat
+
+	handleGetAttachmentBytesRate counterRate
+	getAttachmentBytesRate       counterRate
 }
 
 func NewBlipSyncStats() *BlipSyncStats {
 	return &BlipSyncStats{
-		DeltaEnabledPullReplicationCount: &base.SgwIntStat{}, // global
-		HandleRevCount:                   &base.SgwIntStat{}, // handleRev
-		HandleRevErrorCount:              &base.SgwIntStat{},
-		HandleRevDeltaRecvCount:          &base.SgwIntStat{},
-		HandleRevBytes:                   &base.SgwIntStat{},
-		HandleRevProcessingTime:          &base.SgwIntStat{},
-		HandleRevDocsPurgedCount:         &base.SgwIntStat{},
-		SendRevCount:                     &base.SgwIntStat{}, // sendRev
-		SendRevDeltaRequestedCount:       &base.SgwIntStat{},
-		SendRevDeltaSentCount:            &base.SgwIntStat{},
-		SendRevBytes:                     &base.SgwIntStat{},
-		SendRevErrorTotal:                &base.SgwIntStat{},
-		SendRevErrorConflictCount:        &base.SgwIntStat{},
-		SendRevErrorRejectedCount:        &base.SgwIntStat{},
-		SendRevErrorOtherCount:           &base.SgwIntStat{},
-		HandleChangesCount:               &base.SgwIntStat{}, // handleChanges/handleProposeChanges
-		HandleChangesTime:                &base.SgwIntStat{},
-		HandleChangesDeltaRequestedCount: &base.SgwIntStat{},
-		HandleProveAttachment:            &base.SgwIntStat{}, // handleProveAttachment
-		HandleGetAttachment:              &base.SgwIntStat{}, // handleGetAttachment
-		HandleGetAttachmentBytes:         &base.SgwIntStat{},
-		ProveAttachment:                  &base.SgwIntStat{}, // sendProveAttachment
-		GetAttachment:                    &base.SgwIntStat{}, // sendGetAttachment
-		GetAttachmentBytes:               &base.SgwIntStat{},
-		HandleChangesResponseCount:       &base.SgwIntStat{}, // handleChangesResponse
-		HandleChangesResponseTime:        &base.SgwIntStat{},
-		HandleChangesSendRevCount:        &base.SgwIntStat{}, //  - (duplicates SendRevCount, included for support of CBL expvars)
-		HandleChangesSendRevLatency:      &base.SgwIntStat{},
-		HandleChangesSendRevTime:         &base.SgwIntStat{},
-		SubChangesContinuousActive:       &base.SgwIntStat{}, // subChanges
-		SubChangesContinuousTotal:        &base.SgwIntStat{},
-		SubChangesOneShotActive:          &base.SgwIntStat{},
-		SubChangesOneShotTotal:           &base.SgwIntStat{},
-		SendChangesCount:                 &base.SgwIntStat{},
-		NumConnectAttempts:               &base.SgwIntStat{},
-		NumReconnectsAborted:             &base.SgwIntStat{},
+		DeltaEnabledPullReplicationCount:        &base.SgwIntStat{}, // global
+		HandleRevCount:                          &base.SgwIntStat{}, // handleRev
+		HandleRevErrorCount:                     &base.SgwIntStat{},
+		HandleRevDeltaRecvCount:                 &base.SgwIntStat{},
+		HandleRevBytes:                          &base.SgwIntStat{},
+		HandleRevBytesUncompressed:              &base.SgwIntStat{},
+		HandleRevProcessingTime:                 &base.SgwIntStat{},
+		HandleRevProcessingTimeDistribution:     &base.SgwDurationHistogram{},
+		HandleRevDocsPurgedCount:                &base.SgwIntStat{},
+		SendRevCount:                            &base.SgwIntStat{}, // sendRev
+		SendRevDeltaRequestedCount:              &base.SgwIntStat{},
+		SendRevDeltaSentCount:                   &base.SgwIntStat{},
+		SendRevBytes:                            &base.SgwIntStat{},
+		SendRevBytesUncompressed:                &base.SgwIntStat{},
+		SendRevErrorTotal:                       &base.SgwIntStat{},
+		SendRevErrorConflictCount:               &base.SgwIntStat{},
+		SendRevErrorRejectedCount:               &base.SgwIntStat{},
+		SendRevErrorOtherCount:                  &base.SgwIntStat{},
+		HandleChangesCount:                      &base.SgwIntStat{}, // handleChanges/handleProposeChanges
+		HandleChangesTime:                       &base.SgwIntStat{},
+		HandleChangesDeltaRequestedCount:        &base.SgwIntStat{},
+		HandleProveAttachment:                   &base.SgwIntStat{}, // handleProveAttachment
+		HandleGetAttachment:                     &base.SgwIntStat{}, // handleGetAttachment
+		HandleGetAttachmentBytes:                &base.SgwIntStat{},
+		HandleGetAttachmentBytesRate:            &base.SgwFloatStat{},
+		HandleGetAttachmentThrottled:            &base.SgwIntStat{},
+		HandleGetAttachmentRejected:             &base.SgwIntStat{},
+		ProveAttachment:                         &base.SgwIntStat{}, // sendProveAttachment
+		GetAttachment:                           &base.SgwIntStat{}, // sendGetAttachment
+		GetAttachmentBytes:                      &base.SgwIntStat{},
+		GetAttachmentBytesRate:                  &base.SgwFloatStat{},
+		HandleChangesResponseCount:              &base.SgwIntStat{}, // handleChangesResponse
+		HandleChangesResponseTime:               &base.SgwIntStat{},
+		HandleChangesSendRevCount:               &base.SgwIntStat{}, //  - (duplicates SendRevCount, included for support of CBL expvars)
+		HandleChangesSendRevLatency:             &base.SgwIntStat{},
+		HandleChangesSendRevLatencyDistribution: &base.SgwDurationHistogram{},
+		HandleChangesSendRevTime:                &base.SgwIntStat{},
+		SubChangesContinuousActive:              &base.SgwIntStat{}, // subChanges
+		SubChangesContinuousTotal:               &base.SgwIntStat{},
+		SubChangesOneShotActive:                 &base.SgwIntStat{},
+		SubChangesOneShotTotal:                  &base.SgwIntStat{},
+		SendChangesCount:                        &base.SgwIntStat{},
+		NumConnectAttempts:                      &base.SgwIntStat{},
+		NumReconnectsAborted:                    &base.SgwIntStat{},
 	}
 }
 
@@ -102,20 +132,29 @@ func BlipSyncStatsForCBL(dbStats *base.DbStats) *BlipSyncStats {
 	}
 
 	blipStats.SendRevBytes = dbStats.Database().DocReadsBytesBlip
+	blipStats.SendRevBytesUncompressed = dbStats.Database().DocReadsBytesBlipUncompressed
 	blipStats.SendRevCount = dbStats.Database().NumDocReadsBlip
 
 	blipStats.HandleRevBytes = dbStats.Database().DocWritesBytesBlip
+	blipStats.HandleRevBytesUncompressed = dbStats.Database().DocWritesBytesBlipUncompressed
 	blipStats.HandleRevProcessingTime = dbStats.CBLReplicationPush().WriteProcessingTime
+	blipStats.HandleRevProcessingTimeDistribution = dbStats.CBLReplicationPush().WriteProcessingTimeDistribution
 
 	blipStats.HandleRevCount = dbStats.CBLReplicationPush().DocPushCount
 
 	blipStats.HandleGetAttachment = dbStats.CBLReplicationPull().AttachmentPullCount
 	blipStats.HandleGetAttachmentBytes = dbStats.CBLReplicationPull().AttachmentPullBytes
+	blipStats.HandleGetAttachmentBytesRate = dbStats.CBLReplicationPull().AttachmentPullBytesRate
+	blipStats.HandleGetAttachmentThrottled = dbStats.CBLReplicationPull().AttachmentPullThrottledCount
+	blipStats.HandleGetAttachmentRejected = dbStats.CBLReplicationPull().AttachmentPullThrottledRejected
+
+	blipStats.GetAttachmentLargest = dbStats.CBLReplicationPush().AttachmentPushLargest
 
 	blipStats.HandleChangesResponseCount = dbStats.CBLReplicationPull().RequestChangesCount
 	blipStats.HandleChangesResponseTime = dbStats.CBLReplicationPull().RequestChangesTime
 	blipStats.HandleChangesSendRevCount = dbStats.CBLReplicationPull().RevSendCount
 	blipStats.HandleChangesSendRevLatency = dbStats.CBLReplicationPull().RevSendLatency
+	blipStats.HandleChangesSendRevLatencyDistribution = dbStats.CBLReplicationPull().RevSendLatencyDistribution
 	blipStats.HandleChangesSendRevTime = dbStats.CBLReplicationPull().RevProcessingTime
 
 	// TODO: these are strictly cross-replication stats, maybe do elsewhere?
@@ -139,6 +178,7 @@ func BlipSyncStatsForSGRPush(replicationStats *base.DbReplicatorStats) *BlipSync
 	blipStats.SendRevErrorRejectedCount = replicationStats.PushRejectedCount
 	blipStats.SendRevDeltaSentCount = replicationStats.PushDeltaSentCount
 	blipStats.SendChangesCount = replicationStats.DocsCheckedSent
+	blipStats.HandleChangesSendRevLatencyDistribution = replicationStats.PushRevLatencyDistribution
 	blipStats.NumConnectAttempts = replicationStats.NumConnectAttemptsPush
 	blipStats.NumReconnectsAborted = replicationStats.NumReconnectsAbortedPush
 
@@ -156,8 +196,76 @@ func BlipSyncStatsForSGRPull(replicationStats *base.DbReplicatorStats) *BlipSync
 	blipStats.HandleRevDeltaRecvCount = replicationStats.DeltaReceivedCount
 	blipStats.HandleChangesDeltaRequestedCount = replicationStats.DeltaRequestedCount
 	blipStats.HandleChangesCount = replicationStats.DocsCheckedReceived
+	blipStats.HandleRevProcessingTimeDistribution = replicationStats.PullRevTimeDistribution
 	blipStats.NumConnectAttempts = replicationStats.NumConnectAttemptsPull
 	blipStats.NumReconnectsAborted = replicationStats.NumReconnectsAbortedPull
 
 	return blipStats
 }
+
+// Create BlipSyncStats reflecting both directions of a bidirectional replication.  Connection stats are tracked per
+// direction in DbReplicatorStats, so NumConnectAttempts and NumReconnectsAborted aren't mapped.
+func BlipSyncStatsForSGRBidirectional(replicationStats *base.DbReplicatorStats) *BlipSyncStats {
+	blipStats := NewBlipSyncStats()
+
+	// Push
+	blipStats.HandleGetAttachmentBytes = replicationStats.NumAttachmentBytesPushed
+	blipStats.HandleGetAttachment = replicationStats.NumAttachmentPushed
+	blipStats.SendRevCount = replicationStats.NumDocPushed
+	blipStats.SendRevErrorTotal = replicationStats.NumDocsFailedToPush
+	blipStats.SendRevErrorConflictCount = replicationStats.PushConflictCount
+	blipStats.SendRevErrorRejectedCount = replicationStats.PushRejectedCount
+	blipStats.SendRevDeltaSentCount = replicationStats.PushDeltaSentCount
+	blipStats.SendChangesCount = replicationStats.DocsCheckedSent
+	blipStats.HandleChangesSendRevLatencyDistribution = replicationStats.PushRevLatencyDistribution
+
+	// Pull
+	blipStats.GetAttachmentBytes = replicationStats.NumAttachmentBytesPulled
+	blipStats.GetAttachment = replicationStats.NumAttachmentsPulled
+	blipStats.HandleRevCount = replicationStats.PulledCount
+	blipStats.HandleRevDocsPurgedCount = replicationStats.PurgedCount
+	blipStats.HandleRevErrorCount = replicationStats.FailedToPullCount
+	blipStats.HandleRevDeltaRecvCount = replicationStats.DeltaReceivedCount
+	blipStats.HandleChangesDeltaRequestedCount = replicationStats.DeltaRequestedCount
+	blipStats.HandleChangesCount = replicationStats.DocsCheckedReceived
+	blipStats.HandleRevProcessingTimeDistribution = replicationStats.PullRevTimeDistribution
+
+	return blipStats
+}
+
+// Updates the attachment transfer rate stats from the attachment byte counters.  Intended to be run as a background
+// task every attachmentRateUpdateInterval - must not be called concurrently.
+func (s *BlipSyncStats) updateAttachmentRates(ctx context.Context) error {
+	now := time.Now()
+	s.GetAttachmentBytesRate.Set(s.getAttachmentBytesRate.update(s.GetAttachmentBytes.Value(), now))
+	s.HandleGetAttachmentBytesRate.Set(s.handleGetAttachmentBytesRate.update(s.HandleGetAttachmentBytes.Value(), now))
+	return nil
+}
+
+// counterRate calculates the rate of change of a counter over attachmentRateWindow, from periodic samples.
+type counterRate struct {
+	samples []counterSample // Oldest first
+}
+
+type counterSample struct {
+	value int64
+	time  time.Time
+}
+
+// Adds a sample of the counter's value at now, and returns its rate of change per second since the oldest sample in
+// the window.  Samples are timestamped rather than assumed to be taken every attachmentRateUpdateInterval, so a
+// delayed update doesn't skew the rate.
+func (r *counterRate) update(value int64, now time.Time) float64 {
+	r.samples = append(r.samples, counterSample{value: value, time: now})
+
+	// Retain the latest sample at or before the start of the window, as the baseline for the rate
+	for len(r.samples) > 2 && now.Sub(r.samples[1].time) >= attachmentRateWindow {
+		r.samples = r.samples[1:]
+	}
+	oldest := r.samples[0]
+	elapsed := now.Sub(oldest.time)
+	if len(r.samples) < 2 || elapsed <= 0 {
+		return 0
+	}
+	return float64(value-oldest.value) / elapsed.Seconds()
+}
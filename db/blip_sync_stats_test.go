@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlipSyncStatsForSGRDurationDistributions(t *testing.T) {
+	replicationStats := base.NewSyncGatewayStats().NewDBStats("db").DBReplicatorStats("rep1")
+
+	// Each direction records into the replication's registered histograms
+	BlipSyncStatsForSGRPush(replicationStats).HandleChangesSendRevLatencyDistribution.Record(time.Millisecond)
+	BlipSyncStatsForSGRPull(replicationStats).HandleRevProcessingTimeDistribution.Record(time.Millisecond)
+	assert.Equal(t, uint64(1), replicationStats.PushRevLatencyDistribution.Count())
+	assert.Equal(t, uint64(1), replicationStats.PullRevTimeDistribution.Count())
+
+	bidirectional := BlipSyncStatsForSGRBidirectional(replicationStats)
+	bidirectional.HandleChangesSendRevLatencyDistribution.Record(time.Millisecond)
+	bidirectional.HandleRevProcessingTimeDistribution.Record(time.Millisecond)
+	assert.Equal(t, uint64(2), replicationStats.PushRevLatencyDistribution.Count())
+	assert.Equal(t, uint64(2), replicationStats.PullRevTimeDistribution.Count())
+
+	replicationStats.Reset()
+	assert.Equal(t, uint64(0), replicationStats.PushRevLatencyDistribution.Count())
+	assert.Equal(t, uint64(0), replicationStats.PullRevTimeDistribution.Count())
+}
+
+func TestBlipSyncStatsForSGRBidirectional(t *testing.T) {
+	replicationStats := base.NewSyncGatewayStats().NewDBStats("db").DBReplicatorStats("rep1")
+	push := BlipSyncStatsForSGRPush(replicationStats)
+	pull := BlipSyncStatsForSGRPull(replicationStats)
+	bidirectional := BlipSyncStatsForSGRBidirectional(replicationStats)
+
+	// Each stat is mapped to the same replication stat as in the single direction mapping
+	testCases := []struct {
+		name              string
+		bidirectional     *base.SgwIntStat
+		singleDirection   *base.SgwIntStat
+		replicationMapped *base.SgwIntStat
+	}{
+		{"SendRevCount", bidirectional.SendRevCount, push.SendRevCount, replicationStats.NumDocPushed},
+		{"SendRevErrorTotal", bidirectional.SendRevErrorTotal, push.SendRevErrorTotal, replicationStats.NumDocsFailedToPush},
+		{"SendChangesCount", bidirectional.SendChangesCount, push.SendChangesCount, replicationStats.DocsCheckedSent},
+		{"HandleGetAttachmentBytes", bidirectional.HandleGetAttachmentBytes, push.HandleGetAttachmentBytes, replicationStats.NumAttachmentBytesPushed},
+		{"HandleRevCount", bidirectional.HandleRevCount, pull.HandleRevCount, replicationStats.PulledCount},
+		{"HandleRevErrorCount", bidirectional.HandleRevErrorCount, pull.HandleRevErrorCount, replicationStats.FailedToPullCount},
+		{"HandleChangesCount", bidirectional.HandleChangesCount, pull.HandleChangesCount, replicationStats.DocsCheckedReceived},
+		{"GetAttachmentBytes", bidirectional.GetAttachmentBytes, pull.GetAttachmentBytes, replicationStats.NumAttachmentBytesPulled},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.bidirectional.Add(1)
+			tc.singleDirection.Add(1)
+			assert.Equal(t, int64(2), tc.replicationMapped.Value())
+		})
+	}
+
+	// Connection stats are tracked per direction, so aren't mapped
+	bidirectional.NumConnectAttempts.Add(1)
+	assert.Equal(t, int64(0), replicationStats.NumConnectAttemptsPush.Value())
+	assert.Equal(t, int64(0), replicationStats.NumConnectAttemptsPull.Value())
+}
+
+func TestCounterRate(t *testing.T) {
+	var rate counterRate
+	start := time.Now()
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	// A single sample has no rate
+	assert.Equal(t, 0.0, rate.update(0, at(0)))
+
+	// 100 bytes/sec for the first 10 seconds
+	for i := 1; i <= 10; i++ {
+		assert.InDelta(t, 100.0, rate.update(int64(i*100), at(i)), 0.0001)
+	}
+
+	// Once the counter stops, the rate falls as the window moves past the transfer
+	assert.InDelta(t, 90.0, rate.update(1000, at(11)), 0.0001)
+	assert.InDelta(t, 50.0, rate.update(1000, at(15)), 0.0001)
+	assert.Len(t, rate.samples, 8)
+
+	// A delayed sample is measured from the oldest sample still retained, rather than assuming a regular interval
+	assert.InDelta(t, 0.0, rate.update(1000, at(30)), 0.0001)
+	assert.InDelta(t, 2.5, rate.update(1050, at(35)), 0.0001)
+}
+
+func TestUpdateAttachmentRates(t *testing.T) {
+	stats := NewBlipSyncStats()
+	require.NoError(t, stats.updateAttachmentRates(context.Background()))
+	stats.GetAttachmentBytes.Add(1000)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, stats.updateAttachmentRates(context.Background()))
+
+	assert.True(t, stats.GetAttachmentBytesRate.Value() > 0)
+	assert.Equal(t, 0.0, stats.HandleGetAttachmentBytesRate.Value())
+}
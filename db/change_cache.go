@@ -526,6 +526,7 @@ func (c *changeCache) DocChanged(event sgbucket.FeedEvent) {
 		TimeReceived: event.TimeReceived,
 		TimeSaved:    syncData.TimeSaved,
 		Channels:     syncData.Channels,
+		Cas:          event.Cas,
 	}
 
 	millisecondLatency := int(feedLatency / time.Millisecond)
@@ -0,0 +1,233 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/google/uuid"
+)
+
+// ActiveChangeListener is a snapshot of a changes feed that's currently running.
+type ActiveChangeListener struct {
+	ID                  string     `json:"id"`
+	User                string     `json:"user,omitempty"` // Empty for admin feeds
+	Channels            base.Set   `json:"channels"`       // Channels the feed is currently replicating
+	Since               SequenceID `json:"since"`          // Sequence the feed has reached as of its last wait
+	StartTime           time.Time  `json:"start_time"`
+	Continuous          bool       `json:"continuous"`
+	SendBlockedFraction float64    `json:"send_blocked_fraction"` // Fraction of the feed's active time (excluding waits for changes) spent blocked sending to the consumer, as of its last wait
+}
+
+// ChangesFeedDebugSnapshot is a dump of a running feed's internal state, for diagnosing stuck feeds.
+type ChangesFeedDebugSnapshot struct {
+	ActiveChangeListener
+	Iterations     uint64                  `json:"iterations"`      // Changes iterations the feed has started
+	IterationSince SequenceID              `json:"iteration_since"` // Sequence the current iteration started from
+	ChannelFeeds   []ChannelFeedDebugState `json:"channel_feeds"`   // The current iteration's feeds, in merge order
+}
+
+// ChannelFeedDebugState is the state of one of the feeds merged by a changes iteration.
+type ChannelFeedDebugState struct {
+	Channel      string      `json:"channel"`                  // Channel name, or the user/role doc ID for the user feed
+	Open         bool        `json:"open"`                     // Whether the feed may still return entries
+	Current      *SequenceID `json:"current,omitempty"`        // Sequence of the entry read from the feed but not yet merged, if any
+	CurrentDocID string      `json:"current_doc_id,omitempty"` // Doc ID of the entry read from the feed but not yet merged
+}
+
+// changesFeedDebugState is the internal state of a running feed, published for debug snapshots.  Updated by the feed
+// at the start of each iteration.
+type changesFeedDebugState struct {
+	lock       sync.Mutex
+	iterations uint64
+	since      SequenceID
+	names      []string
+	merger     *changesMerger
+}
+
+// Records the start of a feed iteration merging the named feeds with merger.  names must not be modified afterwards.
+func (s *changesFeedDebugState) startIteration(since SequenceID, names []string, merger *changesMerger) {
+	s.lock.Lock()
+	s.iterations++
+	s.since = since
+	s.names = names
+	s.merger = merger
+	s.lock.Unlock()
+}
+
+func (s *changesFeedDebugState) snapshot() ChangesFeedDebugSnapshot {
+	s.lock.Lock()
+	snapshot := ChangesFeedDebugSnapshot{
+		Iterations:     s.iterations,
+		IterationSince: s.since,
+	}
+	names, merger := s.names, s.merger
+	s.lock.Unlock()
+
+	if merger != nil {
+		snapshot.ChannelFeeds = merger.debugState(names)
+	}
+	return snapshot
+}
+
+// registeredChangeListener is a registry entry for an active feed.
+type registeredChangeListener struct {
+	ActiveChangeListener
+	cancel    chan struct{}          // Closed to cancel the feed
+	cancelled bool                   // Whether cancel has been closed
+	activity  chan struct{}          // Signalled when the feed's consumer is known to be active (see ChangesOptions.IdleTimeout)
+	debug     *changesFeedDebugState // The feed's internal state, for debug snapshots
+}
+
+// changeListenerRegistry is a concurrency-safe registry of the changes feeds active on a database.  Feeds register
+// on start and deregister on close.
+type changeListenerRegistry struct {
+	listeners map[string]*registeredChangeListener
+	lock      sync.RWMutex
+}
+
+func newChangeListenerRegistry() *changeListenerRegistry {
+	return &changeListenerRegistry{
+		listeners: make(map[string]*registeredChangeListener),
+	}
+}
+
+// Registers a new feed, returning the ID used to identify it in the registry, a channel that's closed if the
+// feed is cancelled, and a channel signalled by touch.  The feed publishes its internal state to debug.
+func (r *changeListenerRegistry) register(user string, chans base.Set, options ChangesOptions, debug *changesFeedDebugState) (id string, cancelled <-chan struct{}, activity chan struct{}) {
+	id = uuid.New().String()
+	listener := &registeredChangeListener{
+		ActiveChangeListener: ActiveChangeListener{
+			ID:         id,
+			User:       user,
+			Channels:   chans,
+			Since:      options.Since,
+			StartTime:  time.Now(),
+			Continuous: options.Continuous,
+		},
+		cancel:   make(chan struct{}),
+		activity: make(chan struct{}, 1),
+		debug:    debug,
+	}
+	r.lock.Lock()
+	r.listeners[id] = listener
+	r.lock.Unlock()
+	return id, listener.cancel, listener.activity
+}
+
+func (r *changeListenerRegistry) deregister(id string) {
+	r.lock.Lock()
+	delete(r.listeners, id)
+	r.lock.Unlock()
+}
+
+// Updates the channels and since value for a registered feed.  chans must not be modified by the caller afterwards,
+// as it's shared with snapshots.
+func (r *changeListenerRegistry) update(id string, chans base.Set, since SequenceID) {
+	r.lock.Lock()
+	if listener, ok := r.listeners[id]; ok {
+		listener.Channels = chans
+		listener.Since = since
+	}
+	r.lock.Unlock()
+}
+
+// Records the time a registered feed has spent blocked sending entries to its consumer, out of its total active time.
+func (r *changeListenerRegistry) updateSendBlocked(id string, blocked, active time.Duration) {
+	if active <= 0 {
+		return
+	}
+	r.lock.Lock()
+	if listener, ok := r.listeners[id]; ok {
+		listener.SendBlockedFraction = float64(blocked) / float64(active)
+	}
+	r.lock.Unlock()
+}
+
+// Signals that the consumer of a registered feed is active, e.g. it's acknowledged a heartbeat.
+func (r *changeListenerRegistry) touch(id string) {
+	r.lock.RLock()
+	if listener, ok := r.listeners[id]; ok {
+		signalChangesActivity(listener.activity)
+	}
+	r.lock.RUnlock()
+}
+
+// Non-blocking signal on a feed's activity channel - a pending signal already covers this one.
+func signalChangesActivity(activity chan struct{}) {
+	select {
+	case activity <- struct{}{}:
+	default:
+	}
+}
+
+// Returns a snapshot of the registered feeds, ordered by start time.
+func (r *changeListenerRegistry) snapshot() []ActiveChangeListener {
+	r.lock.RLock()
+	listeners := make([]ActiveChangeListener, 0, len(r.listeners))
+	for _, listener := range r.listeners {
+		listeners = append(listeners, listener.ActiveChangeListener)
+	}
+	r.lock.RUnlock()
+
+	sort.Slice(listeners, func(i, j int) bool {
+		return listeners[i].StartTime.Before(listeners[j].StartTime)
+	})
+	return listeners
+}
+
+// Returns a debug snapshot of a registered feed.  Returns false if the feed isn't registered.
+func (r *changeListenerRegistry) debugSnapshot(id string) (ChangesFeedDebugSnapshot, bool) {
+	r.lock.RLock()
+	listener, ok := r.listeners[id]
+	var summary ActiveChangeListener
+	if ok {
+		summary = listener.ActiveChangeListener
+	}
+	r.lock.RUnlock()
+	if !ok {
+		return ChangesFeedDebugSnapshot{}, false
+	}
+
+	var snapshot ChangesFeedDebugSnapshot
+	if listener.debug != nil {
+		snapshot = listener.debug.snapshot()
+	}
+	snapshot.ActiveChangeListener = summary
+	return snapshot, true
+}
+
+// Cancels a registered feed.  Returns false if the feed isn't registered.
+func (r *changeListenerRegistry) cancel(id string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	listener, ok := r.listeners[id]
+	if !ok {
+		return false
+	}
+	if !listener.cancelled {
+		close(listener.cancel)
+		listener.cancelled = true
+	}
+	return true
+}
+
+// Returns a snapshot of the changes feeds currently active on the database.  Channel sets in the snapshot are
+// shared with the registry and must not be modified.
+func (context *DatabaseContext) ActiveChangeListeners() []ActiveChangeListener {
+	return context.changeListeners.snapshot()
+}
+
+// Terminates the active changes feed with the given ID (as returned by MultiChangesFeedWithID, or listed by
+// ActiveChangeListeners).  Returns false if no feed with that ID is active.
+func (context *DatabaseContext) CancelChangeListener(id string) bool {
+	return context.changeListeners.cancel(id)
+}
+
+// Returns a snapshot of the internal state of the active changes feed with the given ID, e.g. for an admin endpoint
+// diagnosing a stuck feed.  Safe to call while the feed is running, and doesn't affect it.  Returns false if no feed
+// with that ID is active.
+func (context *DatabaseContext) ChangeListenerDebugSnapshot(id string) (ChangesFeedDebugSnapshot, bool) {
+	return context.changeListeners.debugSnapshot(id)
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"log"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/channels"
@@ -122,3 +123,36 @@ func TestUserWaiterForRoleChange(t *testing.T) {
 	// Wait for user notification of updated role
 	require.True(t, WaitForUserWaiterChange(userWaiter))
 }
+
+// Verifies that a ChangeWaiter is only released by notifications for the channels it's registered for.
+func TestChannelWaiterIgnoresUnrelatedChannels(t *testing.T) {
+
+	defer base.SetUpTestLogging(base.LevelInfo, base.KeyChanges)()
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	waiter := db.mutationListener.NewWaiterWithChannels(base.SetOf("A"), nil)
+
+	waitResponse := make(chan uint32, 1)
+	go func() {
+		waitResponse <- waiter.Wait()
+	}()
+
+	// Notification for an unrelated channel shouldn't release the waiter
+	db.mutationListener.Notify(base.SetOf("B"))
+	select {
+	case response := <-waitResponse:
+		t.Fatalf("Waiter for channel A released by notification for channel B, response: %d", response)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Notification for the waiter's channel should release it
+	db.mutationListener.Notify(base.SetOf("A"))
+	select {
+	case response := <-waitResponse:
+		assert.Equal(t, WaiterHasChanges, response)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Waiter for channel A not released by notification for channel A")
+	}
+}
@@ -10,12 +10,18 @@
 package db
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
 	"runtime/debug"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -26,34 +32,128 @@ import (
 // Options for changes-feeds.  ChangesOptions must not contain any mutable pointer references, as
 // changes processing currently assumes a deep copy when doing chanOpts := changesOptions.
 type ChangesOptions struct {
-	Since       SequenceID      // sequence # to start _after_
-	Limit       int             // Max number of changes to return, if nonzero
-	Conflicts   bool            // Show all conflicting revision IDs, not just winning one?
-	IncludeDocs bool            // Include doc body of each change?
-	Wait        bool            // Wait for results, instead of immediately returning empty result?
-	Continuous  bool            // Run continuously until terminated?
-	Terminator  chan bool       // Caller can close this channel to terminate the feed
-	HeartbeatMs uint64          // How often to send a heartbeat to the client
-	TimeoutMs   uint64          // After this amount of time, close the longpoll connection
-	ActiveOnly  bool            // If true, only return information on non-deleted, non-removed revisions
-	clientType  clientType      // Can be used to determine if the replication is being started from a CBL 2.x or SGR2 client
-	Ctx         context.Context // Used for adding context to logs
+	Since                      SequenceID                    // sequence # to start _after_
+	SinceNow                   bool                          // Start after the current cached sequence at feed start, instead of Since.  Must not be used with a non-zero Since.
+	Limit                      int                           // Max number of changes to return, if nonzero
+	Conflicts                  bool                          // Show all conflicting revision IDs, not just winning one?
+	IncludeDocs                bool                          // Include doc body of each change?
+	Wait                       bool                          // Wait for results, instead of immediately returning empty result?
+	Continuous                 bool                          // Run continuously until terminated?
+	Terminator                 chan bool                     // Caller can close this channel to terminate the feed
+	HeartbeatMs                uint64                        // How often to send a heartbeat to the client
+	TimeoutMs                  uint64                        // After this amount of time, close the longpoll connection
+	ActiveOnly                 bool                          // If true, only return information on non-deleted, non-removed revisions.  Only for clients opting out of tombstones - deletions of previously synced docs aren't sent.
+	DocFields                  []string                      // When IncludeDocs is set, restricts the returned body to these top-level properties (plus _id/_rev).  Must not be modified once the feed has started.
+	SendTimeout                time.Duration                 // If non-zero, the feed is terminated when the consumer doesn't accept an entry within this duration
+	LatestOnly                 bool                          // Only send the latest change per doc found in each fetch.  Limit counts a coalesced doc once; continuous feeds coalesce per fetch, not across the stream.
+	DrainOnTerminate           bool                          // When Terminator is closed, flush already-merged entries to the output buffer (without blocking) before closing the feed
+	BackfillMarkers            bool                          // Send a marker entry (see ChangeEntry.BackfillComplete) when backfill of a newly granted channel completes
+	ChannelPattern             *regexp.Regexp                // Also include the user's available channels matching this pattern (see CompileChannelPattern).  Ignored when there's no user.
+	Descending                 bool                          // Return the last Limit entries in descending order (see descendingChangesFeed).  Not supported for continuous or longpoll feeds.
+	InlineUserChanges          bool                          // Instead of sending the user doc entry, set UserAccessChanged on the next entry in the batch (or send a marker entry, not counted towards Limit, if there isn't one)
+	IncludeChannels            bool                          // Set ChangeEntry.Channels to the channels each entry was found in
+	DeltaHints                 bool                          // Set ChangeEntry.DeltaAvailable when delta sync is enabled.  Requires a rev tree lookup per entry.
+	GroupByChannel             bool                          // Send entries grouped by channel within each window of GroupByWindow entries (see groupByChannelChangesFeed)
+	GroupByWindow              int                           // Max number of entries buffered for GroupByChannel - defaults to DefaultGroupByWindow
+	MaxBufferedBytes           int                           // For Descending and GroupByChannel feeds, the max estimated size of the entries buffered in memory, beyond which they're spilled to a temp file - zero means entries are never spilled
+	MinBatchSize               int                           // For continuous feeds, hold entries until this many can be sent together (see minBatchChangesFeed)
+	MinBatchWait               time.Duration                 // Max time an entry is held for MinBatchSize - required with MinBatchSize
+	SkipFailedChannels         bool                          // Omit a channel whose changes can't be retrieved, instead of terminating the feed with an error
+	FailedChannelWarnings      bool                          // With SkipFailedChannels, send a warning entry (see ChangeEntry.FailedChannels) after an iteration that omitted channels
+	MaxDuration                time.Duration                 // If non-zero, the feed is terminated (and output closed) once it's been running for this duration, including continuous feeds
+	IdleTimeout                time.Duration                 // If non-zero, the feed is terminated when no entry is sent or heartbeat acknowledged (see GenerateChanges) within this duration
+	AccessChangesOnly          bool                          // Only send user doc entries for access changes (and heartbeats), without any doc changes.  Ignored when there's no user.
+	AuditSink                  ChangesAuditSink              // If set, records each entry once it's been sent to the feed's output
+	Tracer                     ChangesTracer                 // If set, traces the feed as a span (see ChangesTracer)
+	PriorityChannels           []string                      // Entries from these channels are sent ahead of lower sequences from other channels (see changesMerger.priority).  Must not be modified once the feed has started.
+	Order                      ChangesOrder                  // Selects the next entry merged from the feed's channels, instead of sequence order (see changesMerger.order).  Not supported with PriorityChannels or Unordered.
+	FairScheduling             bool                          // Merge entries from the feed's channels in turn, instead of in sequence order (see changesMerger.fair)
+	OnAccessChange             func(added, removed base.Set) // Called by the feed goroutine when the user's available channels change during a longpoll or continuous feed.  Must not block.
+	MaxDocBytes                int                           // With IncludeDocs, bodies larger than this are omitted and ChangeEntry.DocTooLarge set instead, if non-zero
+	PauseSignal                <-chan struct{}               // Receiving a value pauses sending entries, retaining the feed's state, until a value is received from ResumeSignal.  Terminator still terminates a paused feed, without draining.
+	ResumeSignal               <-chan struct{}               // Resumes a feed paused by PauseSignal
+	Unordered                  bool                          // Send entries from all channels as they arrive, without ordering by sequence (see unorderedChangesSource)
+	StatsInterval              time.Duration                 // For continuous feeds, send an entry with the feed's runtime stats (see ChangeEntry.FeedStats) at most this often
+	EmitCaughtUp               bool                          // For one-shot and longpoll feeds, send a final entry (see ChangeEntry.CaughtUp) when the feed completes.  Not sent when the feed is terminated, stopped by Limit, or fails.
+	ReportInaccessibleChannels bool                          // Send an informational entry (see ChangeEntry.InaccessibleChannel) the first time each requested channel is omitted because it isn't available to the user
+	DocIDs                     []string                      // Only send entries for these doc IDs (plus user doc and marker entries).  Must not be modified once the feed has started.
+	SampleRate                 float64                       // If non-zero, only send this fraction (up to 1.0) of doc entries, chosen at random, for monitoring
+	FieldPredicate             *FieldPredicate               // With IncludeDocs, only sends doc entries whose body matches the predicate (see FieldPredicate.matchesEntry).  Non-matching docs don't count towards Limit.
+	IncludeMetadata            bool                          // Set ChangeEntry.RevGeneration and Cas, e.g. for idempotent upserts by ETL pipelines
+	IncludeRemovalReasons      bool                          // Set ChangeEntry.RemovalReasons on removals
+	ValidateSince              bool                          // Check Since with Database.ValidateSince, and end the feed with an error entry if it's ahead of the database
+	clientType                 clientType                    // Can be used to determine if the replication is being started from a CBL 2.x or SGR2 client
+	Ctx                        context.Context               // Used for adding context to logs
+}
+
+// ChangesAuditSink records the entries delivered by a changes feed (see ChangesOptions.AuditSink).  Record is called
+// synchronously by the feed goroutine, and must not block.  user is empty for admin feeds, and channels is only set
+// when the feed has IncludeChannels set.
+type ChangesAuditSink interface {
+	Record(user, docID string, seq SequenceID, channels []string, timestamp time.Time)
+}
+
+// ChangesTracer starts a span for each changes feed (see ChangesOptions.Tracer), e.g. by adapting an OpenTelemetry
+// tracer.  ctx is the feed's logging context, whose base.LogContext correlation ID identifies the request (or BLIP
+// connection) and feed, so can be used to derive or annotate the trace.  feedID is the feed's listener ID.  The span
+// is started when the feed starts, and ended when its output is closed.
+type ChangesTracer interface {
+	StartFeedSpan(ctx context.Context, feedID string) ChangesSpan
+}
+
+// ChangesSpan is the span of a single changes feed.  The feed records events for the start of each iteration
+// ("iteration"), and for the start and end of backfill ("backfill_start", "backfill_end").  AddEvent and End are
+// called synchronously by the feed goroutine, so must not block.
+type ChangesSpan interface {
+	AddEvent(name string, attributes map[string]interface{})
+	End()
 }
 
 // A changes entry; Database.GetChanges returns an array of these.
 // Marshals into the standard CouchDB _changes format.
 type ChangeEntry struct {
-	Seq          SequenceID      `json:"seq"`
-	ID           string          `json:"id"`
-	Deleted      bool            `json:"deleted,omitempty"`
-	Removed      base.Set        `json:"removed,omitempty"`
-	Doc          json.RawMessage `json:"doc,omitempty"`
-	Changes      []ChangeRev     `json:"changes"`
-	Err          error           `json:"err,omitempty"` // Used to notify feed consumer of errors
-	allRemoved   bool            // Flag to track whether an entry is a removal in all channels visible to the user.
-	branched     bool
-	backfill     backfillFlag // Flag used to identify non-client entries used for backfill synchronization (di only)
-	principalDoc bool         // Used to indicate _user/_role docs
+	Seq                 SequenceID               `json:"seq"`
+	ID                  string                   `json:"id"`
+	Deleted             bool                     `json:"deleted,omitempty"`
+	Removed             base.Set                 `json:"removed,omitempty"`
+	RemovalReasons      map[string]RemovalReason `json:"removal_reasons,omitempty"`   // With ChangesOptions.IncludeRemovalReasons, why the doc was removed from each of the Removed channels
+	RemovedTruncated    bool                     `json:"removed_truncated,omitempty"` // Set when Removed was truncated to ChangesFeedOptions.MaxRemovedChannels channels.  The client can find the doc's full set of removals by fetching it.
+	Doc                 json.RawMessage          `json:"doc,omitempty"`
+	Changes             []ChangeRev              `json:"changes"`
+	Err                 error                    `json:"err,omitempty"`                  // Used to notify feed consumer of errors
+	BackfillComplete    base.Set                 `json:"backfill_complete,omitempty"`    // Set on backfill marker entries to the channels whose backfill has completed.  Markers aren't associated with a doc.
+	UserAccessChanged   bool                     `json:"user_access_changed,omitempty"`  // Set when the user doc has changed since the previous entry (see ChangesOptions.InlineUserChanges).  Set on a marker entry, not associated with a doc, when no other entry follows the user doc.
+	Channels            []string                 `json:"channels,omitempty"`             // With ChangesOptions.IncludeChannels, the (sorted) channels of the feed that each merged entry was found in
+	DeltaAvailable      bool                     `json:"delta_available,omitempty"`      // With ChangesOptions.DeltaHints, set when a delta from the parent revision is likely to be available
+	FailedChannels      base.Set                 `json:"failed_channels,omitempty"`      // Set on warning entries to the channels omitted after an error (see ChangesOptions.SkipFailedChannels).  Warnings aren't associated with a doc.
+	DocTooLarge         bool                     `json:"doc_too_large,omitempty"`        // With ChangesOptions.MaxDocBytes, set when the doc body was omitted for exceeding the limit.  The client should fetch the doc separately.
+	InaccessibleChannel string                   `json:"inaccessible_channel,omitempty"` // With ChangesOptions.ReportInaccessibleChannels, set on informational entries to a requested channel that was omitted.  These aren't associated with a doc.
+	InaccessibleReason  string                   `json:"inaccessible_reason,omitempty"`  // Why InaccessibleChannel was omitted - one of the InaccessibleReason constants
+	FeedStats           *ChangesFeedProgress     `json:"feed_stats,omitempty"`           // With ChangesOptions.StatsInterval, set on stats entries.  These aren't associated with a doc.
+	CaughtUp            bool                     `json:"caught_up,omitempty"`            // With ChangesOptions.EmitCaughtUp, set on the final entry of a completed feed, whose Seq is a checkpoint for everything sent.  Unlike the nil entries sent while a continuous feed waits, this is only sent once, after the last change.
+	RevGeneration       int                      `json:"rev_generation,omitempty"`       // With ChangesOptions.IncludeMetadata, the generation of the entry's revision
+	Cas                 uint64                   `json:"cas,omitempty"`                  // With ChangesOptions.IncludeMetadata, the doc's CAS at the entry's revision.  Only known for entries from the channel cache, not those loaded by channel queries.
+	allRemoved          bool                     // Flag to track whether an entry is a removal in all channels visible to the user.
+	branched            bool
+	backfill            backfillFlag // Flag used to identify non-client entries used for backfill synchronization (di only)
+	principalDoc        bool         // Used to indicate _user/_role docs
+	priorityLowSeq      uint64       // Set by changesMerger when a priority (or ordered) entry is returned ahead of lower sequences, to the sequence preceding them
+}
+
+// RemovalReason is why a doc was removed from a channel (see ChangeEntry.RemovalReasons).
+type RemovalReason string
+
+const (
+	RemovalReasonDeleted       RemovalReason = "deleted"        // The doc was deleted, and its tombstone isn't assigned to the channel
+	RemovalReasonChannelChange RemovalReason = "channel_change" // The sync function stopped assigning the (undeleted) doc to the channel
+)
+
+// Returns the reason for a removal, given whether the removal was a deletion.
+func removalReason(deleted bool) RemovalReason {
+	if deleted {
+		return RemovalReasonDeleted
+	}
+	return RemovalReasonChannelChange
 }
 
 const (
@@ -62,6 +162,21 @@ const (
 	WaiterCheckTerminated
 )
 
+// ChangesFeedProgress is the runtime stats of a single changes feed, sent on stats entries (see ChangesOptions.StatsInterval).
+type ChangesFeedProgress struct {
+	EntriesSent uint64 `json:"entries_sent"` // Entries sent since the feed started, excluding stats entries
+	Wakeups     uint64 `json:"wakeups"`      // Times the feed has been woken up by a change since it started, excluding skipped wakeups
+	InBackfill  bool   `json:"in_backfill"`  // Whether the feed is backfilling a newly granted channel.  The amount remaining isn't known until it's been read.
+}
+
+// Reasons a requested channel is omitted from a changes feed (see ChangeEntry.InaccessibleReason).  A channel that
+// doesn't have any docs can't be distinguished from one the user can't access without a query, so both are reported
+// as InaccessibleReasonNoAccess.
+const (
+	InaccessibleReasonNoAccess = "no_access" // The channel isn't available to the user
+	InaccessibleReasonInvalid  = "invalid"   // The requested name isn't a valid channel name
+)
+
 type backfillFlag int8
 
 const (
@@ -93,6 +208,11 @@ func (db *Database) addDocToChangeEntry(entry *ChangeEntry, options ChangesOptio
 		return
 	}
 
+	// Marker entries (backfill complete, user access changed) don't have a doc
+	if entry.ID == "" {
+		return
+	}
+
 	// Three options for retrieving document content, depending on what's required:
 	//   includeConflicts only:
 	//      - Retrieve document metadata from bucket (required to identify current set of conflicts)
@@ -131,6 +251,75 @@ func (db *Database) addDocToChangeEntry(entry *ChangeEntry, options ChangesOptio
 		}
 	}
 
+	db.limitChangeEntryDoc(entry, options)
+}
+
+// Applies options.DocFields and options.MaxDocBytes to the document body on a ChangeEntry.
+func (db *Database) limitChangeEntryDoc(entry *ChangeEntry, options ChangesOptions) {
+	if options.IncludeDocs && len(options.DocFields) > 0 {
+		db.projectChangeEntryDoc(entry, options.DocFields)
+	}
+
+	// The limit applies after projection, to the body that would be sent
+	if options.MaxDocBytes > 0 && len(entry.Doc) > options.MaxDocBytes {
+		base.DebugfCtx(db.Ctx, base.KeyChanges, "Changes feed: omitting body of %q (%d bytes) exceeding MaxDocBytes", base.UD(entry.ID), len(entry.Doc))
+		entry.Doc = nil
+		entry.DocTooLarge = true
+	}
+}
+
+// Sets DeltaAvailable on a ChangeEntry when a delta from the parent of the entry's revision can be generated - a client
+// that has synced the previous revision can request the revision as a delta.  Only the revision cache is checked, so
+// this is a hint: a delta may still be generated from an old revision body that's no longer cached.
+func (db *Database) addDeltaHintToChangeEntry(entry *ChangeEntry) {
+	if !db.DeltaSyncEnabled() || entry.principalDoc || entry.ID == "" {
+		return
+	}
+
+	syncData, err := db.GetDocSyncData(entry.ID)
+	if err != nil {
+		base.WarnfCtx(db.Ctx, "Changes feed: error getting doc sync data %q: %v", base.UD(entry.ID), err)
+		return
+	}
+
+	parentRevID := syncData.History.getParent(entry.Changes[0]["rev"])
+	if parentRevID == "" {
+		return
+	}
+	_, entry.DeltaAvailable = db.revisionCache.Peek(entry.ID, parentRevID)
+}
+
+// Reduces the document body on a ChangeEntry to the given top-level properties.  Special properties identifying
+// the revision (_id, _rev, _deleted) are always retained.
+func (db *Database) projectChangeEntryDoc(entry *ChangeEntry, fields []string) {
+	if len(entry.Doc) == 0 {
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := base.JSONUnmarshal(entry.Doc, &body); err != nil {
+		base.WarnfCtx(db.Ctx, "Changes feed: unable to project fields for doc %q: %v", base.UD(entry.ID), err)
+		return
+	}
+
+	projected := make(map[string]json.RawMessage, len(fields)+3)
+	for _, key := range []string{BodyId, BodyRev, BodyDeleted} {
+		if value, ok := body[key]; ok {
+			projected[key] = value
+		}
+	}
+	for _, field := range fields {
+		if value, ok := body[field]; ok {
+			projected[field] = value
+		}
+	}
+
+	projectedBytes, err := base.JSONMarshal(projected)
+	if err != nil {
+		base.WarnfCtx(db.Ctx, "Changes feed: unable to marshal projected body for doc %q: %v", base.UD(entry.ID), err)
+		return
+	}
+	entry.Doc = projectedBytes
 }
 
 func (db *Database) AddDocToChangeEntryUsingRevCache(entry *ChangeEntry, revID string) (err error) {
@@ -170,6 +359,69 @@ func (db *Database) AddDocInstanceToChangeEntry(entry *ChangeEntry, doc *Documen
 	}
 }
 
+// Default delay before retrying a failed channel changes query, when ChangesFeedOptions.QueryRetryDelay isn't set
+const DefaultChangesQueryRetryDelay = 100 * time.Millisecond
+
+// ChangesFeedThresholds are the limits above which a changes feed is considered unhealthy, and a warning identifying the
+// feed is logged.  Zero values use the corresponding default, and negative values disable the warning.
+type ChangesFeedThresholds struct {
+	ExpandedChannels    int // Channels available to the feed's user.  Every iteration of a feed starts a channel feed per available channel, so large grants make every iteration expensive.  Logged at info rather than warn.
+	BackfillEntries     int // Backfilled entries sent by a feed.  Large backfills are caused by granting channels with many docs to existing users.
+	UnproductiveWakeups int // Consecutive wakeups of a feed that didn't send anything (logged again after each further run).  Indicates the feed is repeatedly notified of changes that aren't visible to it.
+}
+
+// Default ChangesFeedThresholds
+const (
+	DefaultExpandedChannelsWarningThreshold    = 1000
+	DefaultBackfillEntriesWarningThreshold     = 100000
+	DefaultUnproductiveWakeupsWarningThreshold = 100
+)
+
+// Returns threshold, or defaultThreshold when it isn't set.  Returns -1 when the warning is disabled.
+func changesFeedThreshold(threshold, defaultThreshold int) int {
+	if threshold == 0 {
+		return defaultThreshold
+	}
+	if threshold < 0 {
+		return -1
+	}
+	return threshold
+}
+
+// Returns a random delay in [0, max) to wait before re-fetching changes after a wakeup, or zero when max isn't set.
+func changesWakeupJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Retrieves changes from the channel cache.  Failed queries are retried ChangesFeedOptions.QueryRetryAttempts times,
+// with a doubling delay between attempts.  Stops retrying and returns the last error if options.Terminator is closed.
+func (db *Database) getChannelChangesWithRetry(singleChannelCache SingleChannelCache, options ChangesOptions) ([]*LogEntry, error) {
+	retryDelay := db.Options.ChangesFeedOptions.QueryRetryDelay
+	if retryDelay <= 0 {
+		retryDelay = DefaultChangesQueryRetryDelay
+	}
+	sleeper := base.CreateDoublingSleeperFunc(db.Options.ChangesFeedOptions.QueryRetryAttempts, int(retryDelay/time.Millisecond))
+	for attempt := 1; ; attempt++ {
+		changes, err := singleChannelCache.GetChanges(options)
+		if err == nil {
+			return changes, nil
+		}
+		shouldRetry, sleepMs := sleeper(attempt)
+		if !shouldRetry {
+			return nil, err
+		}
+		base.DebugfCtx(db.Ctx, base.KeyChanges, "Retrying changes query for channel %q after %d ms, error: %v", base.UD(singleChannelCache.ChannelName()), sleepMs, err)
+		select {
+		case <-options.Terminator:
+			return nil, err
+		case <-time.After(time.Duration(sleepMs) * time.Millisecond):
+		}
+	}
+}
+
 // Creates a Go-channel of all the changes made on a channel.
 // Does NOT handle the Wait option. Does NOT check authorization.
 func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options ChangesOptions, to string) <-chan *ChangeEntry {
@@ -186,11 +438,37 @@ func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options C
 	paginationOptions.Since.Seq = options.Since.SafeSequence()
 	paginationOptions.Since.LowSeq = 0
 
+	// Backfill ends when the feed reaches the triggering sequence, or when the channel has no further entries.
+	// Feeds resuming at or after the triggering sequence have already completed backfill.
+	triggeredBy := options.Since.TriggeredBy
+	backfilling := triggeredBy > 0 && options.Since.Seq < triggeredBy
+
 	go func() {
 		defer base.FatalPanicHandler()
 		defer close(feed)
 		var itemsSent int
 		var lastSeq uint64
+
+		// Logs the end of backfill and sends the backfill marker, if requested.  Returns false if the feed was
+		// terminated while sending the marker.
+		endBackfill := func() bool {
+			backfilling = false
+			db.logChangesEvent(base.LevelDebug, "backfill_end", map[string]interface{}{"channel": base.UD(singleChannelCache.ChannelName()), "seq": triggeredBy},
+				"Channel feed completed backfill triggered by %d in channel %s %s", triggeredBy, base.UD(singleChannelCache.ChannelName()), base.UD(to))
+			if !options.BackfillMarkers {
+				return true
+			}
+			marker := makeBackfillMarkerEntry(triggeredBy, singleChannelCache.ChannelName())
+			select {
+			case <-options.Terminator:
+				db.logChangesEvent(base.LevelDebug, "terminate", map[string]interface{}{"channel": base.UD(singleChannelCache.ChannelName())},
+					"Terminating channel feed %s", base.UD(to))
+				return false
+			case feed <- &marker:
+				return true
+			}
+		}
+
 		// Pagination based on ChannelQueryLimit.  This loop may terminated in three ways (see return statements):
 		//   1. Query returns fewer rows than ChannelQueryLimit
 		//   2. A limit is specified on the incoming ChangesOptions, and that limit is reached
@@ -205,13 +483,23 @@ func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options C
 			}
 
 			// TODO: pass db.Ctx down to changeCache?
-			changes, err := singleChannelCache.GetChanges(paginationOptions)
+			changes, err := db.getChannelChangesWithRetry(singleChannelCache, paginationOptions)
 			if err != nil {
+				// Don't report an error when terminated while waiting to retry
+				select {
+				case <-options.Terminator:
+					return
+				default:
+				}
 				base.WarnfCtx(db.Ctx, "Error retrieving changes for channel %q: %v", base.UD(singleChannelCache.ChannelName()), err)
 				change := ChangeEntry{
-					Err: base.ErrChannelFeed,
+					Err:            base.ErrChannelFeed,
+					FailedChannels: base.SetOf(singleChannelCache.ChannelName()),
+				}
+				select {
+				case <-options.Terminator:
+				case feed <- &change:
 				}
-				feed <- &change
 				return
 			}
 			base.DebugfCtx(db.Ctx, base.KeyChanges, "[changesFeed] Found %d changes for channel %q", len(changes), base.UD(singleChannelCache.ChannelName()))
@@ -219,6 +507,9 @@ func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options C
 			// Now write each log entry to the 'feed' channel in turn:
 			for _, logEntry := range changes {
 				if logEntry.Sequence >= options.Since.TriggeredBy {
+					if backfilling && !endBackfill() {
+						return
+					}
 					options.Since.TriggeredBy = 0
 				}
 				seqID := SequenceID{
@@ -226,20 +517,35 @@ func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options C
 					TriggeredBy: options.Since.TriggeredBy,
 				}
 
-				change := makeChangeEntry(logEntry, seqID, singleChannelCache.ChannelName())
+				change := getChangeEntry()
+				*change = makeChangeEntry(logEntry, seqID, singleChannelCache.ChannelName(), options.IncludeMetadata, options.IncludeRemovalReasons)
+				if options.IncludeChannels {
+					change.Channels = []string{singleChannelCache.ChannelName()}
+				}
 
-				base.DebugfCtx(db.Ctx, base.KeyChanges, "Channel feed processing seq:%v in channel %s %s", seqID, base.UD(singleChannelCache.ChannelName()), base.UD(to))
+				// Logged per entry, so the event fields are only built when they'll be logged
+				if base.JSONLogging && base.LogDebugEnabled(base.KeyChanges) {
+					db.logChangesEvent(base.LevelDebug, "channel_entry", map[string]interface{}{"channel": base.UD(singleChannelCache.ChannelName()), "id": base.UD(logEntry.DocID), "seq": seqID.String(), "vbNo": logEntry.VbNo},
+						"Channel feed processing seq:%v in channel %s %s", seqID, base.UD(singleChannelCache.ChannelName()), base.UD(to))
+				} else {
+					base.DebugfCtx(db.Ctx, base.KeyChanges, "Channel feed processing seq:%v in channel %s %s", seqID, base.UD(singleChannelCache.ChannelName()), base.UD(to))
+				}
 				select {
 				case <-options.Terminator:
-					base.DebugfCtx(db.Ctx, base.KeyChanges, "Terminating channel feed %s", base.UD(to))
+					db.logChangesEvent(base.LevelDebug, "terminate", map[string]interface{}{"channel": base.UD(singleChannelCache.ChannelName())},
+						"Terminating channel feed %s", base.UD(to))
+					returnChangeEntry(change)
 					return
-				case feed <- &change:
+				case feed <- change:
 					lastSeq = logEntry.Sequence
 				}
 			}
 
 			// If the query returned fewer results than the query limit, we're done
 			if len(changes) < queryLimit {
+				if backfilling {
+					endBackfill()
+				}
 				return
 			}
 
@@ -255,7 +561,28 @@ func (db *Database) changesFeed(singleChannelCache SingleChannelCache, options C
 	return feed
 }
 
-func makeChangeEntry(logEntry *LogEntry, seqID SequenceID, channelName string) ChangeEntry {
+//////// CHANGE ENTRY POOL:
+
+// Pool of entries used by channel feeds.  Entries sent to the consumer of a changes feed belong to the consumer
+// and are never returned to the pool - only entries discarded during merge (e.g. entries for the same sequence
+// in more than one channel) are recycled.
+var changeEntryPool sync.Pool
+
+// Gets an entry from the pool, or creates a new one if the pool is empty:
+func getChangeEntry() *ChangeEntry {
+	if entry, ok := changeEntryPool.Get().(*ChangeEntry); ok {
+		return entry
+	}
+	return &ChangeEntry{}
+}
+
+// Clears an entry that's no longer referenced and returns it to the pool:
+func returnChangeEntry(entry *ChangeEntry) {
+	*entry = ChangeEntry{}
+	changeEntryPool.Put(entry)
+}
+
+func makeChangeEntry(logEntry *LogEntry, seqID SequenceID, channelName string, includeMetadata, includeRemovalReasons bool) ChangeEntry {
 	change := ChangeEntry{
 		Seq:          seqID,
 		ID:           logEntry.DocID,
@@ -267,15 +594,67 @@ func makeChangeEntry(logEntry *LogEntry, seqID SequenceID, channelName string) C
 
 	if logEntry.Flags&channels.Removed != 0 {
 		change.Removed = base.SetOf(channelName)
+		if includeRemovalReasons {
+			change.RemovalReasons = map[string]RemovalReason{channelName: removalReason(logEntry.Flags&channels.Deleted != 0)}
+		}
+	}
+
+	if includeMetadata && !logEntry.IsPrincipal {
+		change.RevGeneration = genOfRevID(logEntry.RevID)
+		change.Cas = logEntry.Cas
 	}
 
 	return change
 }
 
+// Creates the marker entry sent when backfill triggered by the given sequence completes for a channel.  The marker's
+// sequence (triggeredBy:triggeredBy) sorts after all of the backfilled entries, and before the triggering sequence.
+func makeBackfillMarkerEntry(triggeredBy uint64, channelName string) ChangeEntry {
+	return ChangeEntry{
+		Seq: SequenceID{
+			Seq:         triggeredBy,
+			TriggeredBy: triggeredBy,
+		},
+		Changes:          []ChangeRev{},
+		BackfillComplete: base.SetOf(channelName),
+	}
+}
+
 func (ce *ChangeEntry) SetBranched(isBranched bool) {
 	ce.branched = isBranched
 }
 
+// Adds reasons to the entry's RemovalReasons, e.g. when merging the removals of an entry found in more than one channel.
+func (ce *ChangeEntry) addRemovalReasons(reasons map[string]RemovalReason) {
+	if len(reasons) == 0 {
+		return
+	}
+	if ce.RemovalReasons == nil {
+		ce.RemovalReasons = make(map[string]RemovalReason, len(reasons))
+	}
+	for channelName, reason := range reasons {
+		ce.RemovalReasons[channelName] = reason
+	}
+}
+
+// Truncates Removed (and RemovalReasons) to the first maxRemoved channels by name, setting RemovedTruncated.
+func (ce *ChangeEntry) truncateRemoved(maxRemoved int) {
+	removed := ce.Removed.ToArray()
+	sort.Strings(removed)
+	ce.Removed = base.SetFromArray(removed[:maxRemoved])
+	for _, channelName := range removed[maxRemoved:] {
+		delete(ce.RemovalReasons, channelName)
+	}
+	ce.RemovedTruncated = true
+}
+
+// Returns true for entries that aren't associated with a doc - backfill, user and caught up markers, warnings, and
+// inaccessible channel and stats entries.  These don't count towards ChangesOptions.Limit.
+func (ce *ChangeEntry) isMarker() bool {
+	return ce.ID == "" && (ce.BackfillComplete != nil || ce.UserAccessChanged || ce.CaughtUp || ce.FailedChannels != nil ||
+		ce.InaccessibleChannel != "" || ce.FeedStats != nil)
+}
+
 func (ce *ChangeEntry) String() string {
 
 	var deletedString, removedString, errString, allRemovedString, branchedString, backfillString string
@@ -300,6 +679,97 @@ func (ce *ChangeEntry) String() string {
 	return fmt.Sprintf("{Seq:%s, ID:%s, Changes:%s%s%s%s%s%s%s}", ce.Seq, ce.ID, ce.Changes, deletedString, removedString, errString, allRemovedString, branchedString, backfillString)
 }
 
+// Writes the entry to w as a single line of JSON, for newline-delimited JSON (NDJSON) streams.  The sequence is
+// written in the same form as the REST changes feed, which can be used as a since value to resume the feed.
+func (ce *ChangeEntry) WriteNDJSON(w io.Writer) error {
+	data, err := base.JSONMarshal(ce)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Writes each entry from feed to w as a line of JSON (see ChangeEntry.WriteNDJSON) until the feed is closed.  w is
+// flushed after each line if it's an http.Flusher.  Nil entries (sent while the feed is waiting for changes) are
+// written as the keepalive line when keepalive is non-nil, and skipped otherwise.  Returns on the first write error
+// without draining the feed - the caller should then close the feed's terminator.
+func WriteChangesNDJSON(feed <-chan *ChangeEntry, w io.Writer, keepalive []byte) error {
+	flusher, _ := w.(http.Flusher)
+	var keepaliveLine []byte
+	if keepalive != nil {
+		keepaliveLine = append(append([]byte{}, keepalive...), '\n')
+	}
+	for entry := range feed {
+		var err error
+		if entry != nil {
+			err = entry.WriteNDJSON(w)
+		} else if keepaliveLine != nil {
+			_, err = w.Write(keepaliveLine)
+		} else {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+// Same as WriteChangesNDJSON, but gzip compresses the output as entries are written, so a large feed is never
+// materialized in full before compression.  The gzip stream is flushed with each line, and completed once the feed
+// closes - the caller is responsible for setting Content-Encoding.  Compressed and uncompressed bytes are added to the
+// changes feed stats as they're written.
+func (db *Database) WriteChangesNDJSONGzip(feed <-chan *ChangeEntry, w io.Writer, keepalive []byte) error {
+	stats := db.DbStats.ChangesFeed()
+	flusher, _ := w.(http.Flusher)
+	gzw := &gzipChangesWriter{
+		gz:      gzip.NewWriter(countedWriter{w: w, stat: stats.GzipBytes}),
+		flusher: flusher,
+		stat:    stats.GzipBytesUncompressed,
+	}
+	err := WriteChangesNDJSON(feed, gzw, keepalive)
+	if closeErr := gzw.gz.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Compresses writes to the underlying writer, and flushes the compressed output to it on Flush.
+type gzipChangesWriter struct {
+	gz      *gzip.Writer
+	flusher http.Flusher     // The underlying writer, when it's an http.Flusher
+	stat    *base.SgwIntStat // Incremented by the uncompressed bytes written
+}
+
+func (w *gzipChangesWriter) Write(b []byte) (int, error) {
+	n, err := w.gz.Write(b)
+	w.stat.Add(int64(n))
+	return n, err
+}
+
+func (w *gzipChangesWriter) Flush() {
+	_ = w.gz.Flush()
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+}
+
+// Increments stat by the bytes written to w.
+type countedWriter struct {
+	w    io.Writer
+	stat *base.SgwIntStat
+}
+
+func (w countedWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.stat.Add(int64(n))
+	return n, err
+}
+
 func makeErrorEntry(message string) ChangeEntry {
 
 	change := ChangeEntry{
@@ -308,19 +778,401 @@ func makeErrorEntry(message string) ChangeEntry {
 	return change
 }
 
+// ChangesFeeder is implemented by types that can produce a merged changes feed across a set of channels.  Allows
+// callers (e.g. REST handlers and tests) to depend on feed generation without requiring a *Database.
+type ChangesFeeder interface {
+	MultiChangesFeed(chans base.Set, options ChangesOptions) (<-chan *ChangeEntry, error)
+}
+
+var _ ChangesFeeder = &Database{}
+
 func (db *Database) MultiChangesFeed(chans base.Set, options ChangesOptions) (<-chan *ChangeEntry, error) {
-	if len(chans) == 0 {
-		return nil, nil
+	feed, _, err := db.MultiChangesFeedWithID(chans, options)
+	return feed, err
+}
+
+// Returns a feed of the changes after any of the given checkpoints, by starting the feed from the earliest of them.
+// options.Since is ignored.  Consumers up to date with a later checkpoint will receive changes they've already seen.
+func (db *Database) MultiChangesFeedSinceAny(chans base.Set, options ChangesOptions, sinces []SequenceID) (<-chan *ChangeEntry, error) {
+	options.Since = MinSequenceID(sinces...)
+	return db.MultiChangesFeed(chans, options)
+}
+
+// Same as MultiChangesFeed, but also returns the ID identifying the feed in ActiveChangeListeners, which can be
+// passed to CancelChangeListener.  The ID is empty when no feed is started.
+func (db *Database) MultiChangesFeedWithID(chans base.Set, options ChangesOptions) (<-chan *ChangeEntry, string, error) {
+	if len(chans) == 0 && options.ChannelPattern == nil {
+		return nil, "", nil
 	}
 
 	if (options.Continuous || options.Wait) && options.Terminator == nil {
 		base.WarnfCtx(db.Ctx, "MultiChangesFeed: Terminator missing for Continuous/Wait mode")
 	}
+
+	if options.Unordered && (options.Limit > 0 || options.LatestOnly || options.Descending) {
+		return nil, "", base.HTTPErrorf(http.StatusBadRequest, "Unordered can't be used with Limit, LatestOnly or Descending")
+	}
+
+	if options.FieldPredicate != nil {
+		if err := options.FieldPredicate.validate(options); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if options.SampleRate < 0 || options.SampleRate > 1 {
+		return nil, "", base.HTTPErrorf(http.StatusBadRequest, "SampleRate must be between 0 and 1")
+	}
+
+	if options.Order != nil && (options.PriorityChannels != nil || options.Unordered) {
+		return nil, "", base.HTTPErrorf(http.StatusBadRequest, "Order can't be used with PriorityChannels or Unordered")
+	}
+
+	if options.FairScheduling && (options.Order != nil || options.PriorityChannels != nil || options.Unordered) {
+		return nil, "", base.HTTPErrorf(http.StatusBadRequest, "FairScheduling can't be used with Order, PriorityChannels or Unordered")
+	}
+
+	if options.GroupByChannel {
+		if options.Continuous {
+			return nil, "", base.HTTPErrorf(http.StatusBadRequest, "GroupByChannel can't be used with continuous changes feeds")
+		}
+		// Entries are grouped by the channels they were found in
+		options.IncludeChannels = true
+		window := options.GroupByWindow
+		if window <= 0 {
+			window = DefaultGroupByWindow
+		}
+		options.GroupByChannel = false
+		feed, listenerID, err := db.MultiChangesFeedWithID(chans, options)
+		if err != nil || feed == nil {
+			return feed, listenerID, err
+		}
+		return groupByChannelChangesFeed(feed, window, options.MaxBufferedBytes, options.Terminator), listenerID, nil
+	}
+
+	if options.MinBatchSize > 1 {
+		if !options.Continuous {
+			return nil, "", base.HTTPErrorf(http.StatusBadRequest, "MinBatchSize can only be used with continuous changes feeds")
+		}
+		if options.MinBatchWait <= 0 {
+			return nil, "", base.HTTPErrorf(http.StatusBadRequest, "MinBatchSize requires MinBatchWait")
+		}
+		minBatchSize := options.MinBatchSize
+		options.MinBatchSize = 0
+		feed, listenerID, err := db.MultiChangesFeedWithID(chans, options)
+		if err != nil || feed == nil {
+			return feed, listenerID, err
+		}
+		return minBatchChangesFeed(feed, minBatchSize, options.MinBatchWait, options.Terminator), listenerID, nil
+	}
+
+	if options.Descending {
+		if options.Continuous || options.Wait {
+			return nil, "", base.HTTPErrorf(http.StatusBadRequest, "Descending can't be used with continuous or longpoll changes feeds")
+		}
+		// The full feed is needed to find the last Limit entries
+		limit := options.Limit
+		options.Limit = 0
+		feed, listenerID, err := db.SimpleMultiChangesFeed(chans, options)
+		if err != nil {
+			return nil, "", err
+		}
+		return descendingChangesFeed(feed, limit, options.MaxBufferedBytes, options.Terminator), listenerID, nil
+	}
+
 	base.DebugfCtx(db.Ctx, base.KeyChanges, "Int sequence multi changes feed...")
 	return db.SimpleMultiChangesFeed(chans, options)
 
 }
 
+// Default number of entries buffered by a GroupByChannel feed, when ChangesOptions.GroupByWindow isn't set
+const DefaultGroupByWindow = 100
+
+// Buffers windows of up to windowSize entries from feed, and sends each window's entries grouped by channel.  Groups
+// are sent in the order of their channel's first entry in the window, and entries within a group keep their feed order,
+// so sequences are only ascending within a channel's group.  An entry found in more than one channel is grouped with
+// the first of its Channels, and entries not associated with a channel (e.g. user docs) are grouped together.  The
+// window is also flushed when the feed sends a nil entry (waiting for changes), which is then forwarded.  When
+// maxBufferedBytes is set, the window's groups are spilled to disk whenever their entries' estimated size exceeds it.
+func groupByChannelChangesFeed(feed <-chan *ChangeEntry, windowSize int, maxBufferedBytes int, terminator chan bool) <-chan *ChangeEntry {
+	output := make(chan *ChangeEntry, 50)
+	go func() {
+		defer base.FatalPanicHandler()
+		defer close(output)
+
+		var groupOrder []string
+		groups := make(map[string]*changeEntrySpillBuffer)
+		defer func() {
+			for _, group := range groups {
+				group.close()
+			}
+		}()
+		buffered := 0
+		bufferedBytes := 0
+		send := func(entry *ChangeEntry) bool {
+			select {
+			case <-terminator:
+				return false
+			case output <- entry:
+				return true
+			}
+		}
+		sendBufferError := func(err error) {
+			base.Warnf("Unable to buffer changes for GroupByChannel: %v", err)
+			change := makeErrorEntry("Unable to buffer changes - terminating changes feed")
+			send(&change)
+		}
+		flush := func() bool {
+			for _, channelName := range groupOrder {
+				group := groups[channelName]
+				sent := true
+				if err := group.forEach(false, func(entry *ChangeEntry) bool {
+					sent = send(entry)
+					return sent
+				}); err != nil {
+					sendBufferError(err)
+					return false
+				}
+				if !sent {
+					return false
+				}
+				group.close()
+				delete(groups, channelName)
+			}
+			groupOrder = groupOrder[:0]
+			buffered = 0
+			bufferedBytes = 0
+			return true
+		}
+
+		for entry := range feed {
+			if entry == nil || entry.Err != nil {
+				if !flush() || !send(entry) {
+					return
+				}
+				// An error entry terminates the feed
+				if entry != nil {
+					return
+				}
+				continue
+			}
+			channelName := ""
+			if len(entry.Channels) > 0 {
+				channelName = entry.Channels[0]
+			}
+			group, ok := groups[channelName]
+			if !ok {
+				group = newChangeEntrySpillBuffer(0)
+				groups[channelName] = group
+				groupOrder = append(groupOrder, channelName)
+			}
+			if err := group.append(entry); err != nil {
+				sendBufferError(err)
+				return
+			}
+			buffered++
+			bufferedBytes += estimatedChangeEntrySize(entry)
+			if maxBufferedBytes > 0 && bufferedBytes > maxBufferedBytes {
+				for _, group := range groups {
+					if err := group.spill(); err != nil {
+						sendBufferError(err)
+						return
+					}
+				}
+				bufferedBytes = 0
+			}
+			if buffered >= windowSize && !flush() {
+				return
+			}
+		}
+		flush()
+	}()
+	return output
+}
+
+// Holds entries from feed until minBatchSize of them can be sent together, or minBatchWait has elapsed since the first
+// was held.  Entries keep their feed order, so the sequences sent are still resumable checkpoints.  A nil entry
+// (waiting for changes) is forwarded after any held entries are flushed.  Error entries, the end of the feed and
+// termination flush held entries immediately - once terminated, only to the output buffer, without blocking.  This
+// trades latency for fewer, larger writes to the clients of chatty feeds.
+func minBatchChangesFeed(feed <-chan *ChangeEntry, minBatchSize int, minBatchWait time.Duration, terminator chan bool) <-chan *ChangeEntry {
+	output := make(chan *ChangeEntry, 50)
+	go func() {
+		defer base.FatalPanicHandler()
+		defer close(output)
+
+		var batch []*ChangeEntry
+		var waiting bool // Whether the feed sent a nil entry while entries were held
+		var flushTimer *time.Timer
+		var flushDue <-chan time.Time
+		flush := func() bool {
+			if flushTimer != nil {
+				flushTimer.Stop()
+				flushTimer, flushDue = nil, nil
+			}
+			for i, entry := range batch {
+				select {
+				case <-terminator:
+					for _, entry := range batch[i:] {
+						select {
+						case output <- entry:
+						default:
+							return false
+						}
+					}
+					return false
+				case output <- entry:
+				}
+			}
+			batch = batch[:0]
+			if waiting {
+				waiting = false
+				select {
+				case <-terminator:
+					return false
+				case output <- nil:
+				}
+			}
+			return true
+		}
+
+		for {
+			select {
+			case <-terminator:
+				flush()
+				return
+			case <-flushDue:
+				if !flush() {
+					return
+				}
+			case entry, ok := <-feed:
+				if !ok {
+					flush()
+					return
+				}
+				if entry == nil {
+					waiting = true
+					if len(batch) == 0 && !flush() {
+						return
+					}
+					continue
+				}
+				batch = append(batch, entry)
+				// An error entry terminates the feed
+				if entry.Err != nil {
+					flush()
+					return
+				}
+				if len(batch) == 1 {
+					flushTimer = time.NewTimer(minBatchWait)
+					flushDue = flushTimer.C
+				}
+				if len(batch) >= minBatchSize && !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return output
+}
+
+// Reads a one-shot feed to completion, then sends the last limit entries (all entries when limit is zero) in
+// reverse order.  Only the last limit entries are buffered.  Backfill is inherently forward - backfilled entries
+// (with non-zero TriggeredBy) are sent at their position in the forward feed, so the result isn't strictly
+// descending by Seq when the feed includes a backfill.  If the feed sends an error, the error is sent in place of
+// the buffered entries.  When maxBufferedBytes is set, the entries are buffered with a changeEntrySpillBuffer instead,
+// so that entries beyond maxBufferedBytes are spilled to disk.
+func descendingChangesFeed(feed <-chan *ChangeEntry, limit int, maxBufferedBytes int, terminator chan bool) <-chan *ChangeEntry {
+	output := make(chan *ChangeEntry, 50)
+	go func() {
+		defer base.FatalPanicHandler()
+		defer close(output)
+		if maxBufferedBytes > 0 {
+			sendSpilledDescendingChanges(feed, limit, maxBufferedBytes, output, terminator)
+			return
+		}
+		var window []*ChangeEntry
+		for entry := range feed {
+			if entry == nil {
+				continue
+			}
+			if entry.Err != nil {
+				select {
+				case <-terminator:
+				case output <- entry:
+				}
+				return
+			}
+			window = append(window, entry)
+			if limit > 0 && len(window) > limit {
+				window = window[1:]
+			}
+		}
+		for i := len(window) - 1; i >= 0; i-- {
+			select {
+			case <-terminator:
+				return
+			case output <- window[i]:
+			}
+		}
+	}()
+	return output
+}
+
+// Implements descendingChangesFeed for a non-zero maxBufferedBytes.  As with the in-memory window, only the last limit
+// entries are buffered (rounded out to whole spilled segments), but only up to maxBufferedBytes of them are held in
+// memory.
+func sendSpilledDescendingChanges(feed <-chan *ChangeEntry, limit int, maxBufferedBytes int, output chan<- *ChangeEntry, terminator chan bool) {
+	buffer := newChangeEntrySpillBuffer(maxBufferedBytes)
+	defer buffer.close()
+	sendBufferError := func(err error) {
+		base.Warnf("Unable to buffer changes for Descending: %v", err)
+		change := makeErrorEntry("Unable to buffer changes - terminating changes feed")
+		select {
+		case <-terminator:
+		case output <- &change:
+		}
+	}
+
+	for entry := range feed {
+		if entry == nil {
+			continue
+		}
+		if entry.Err != nil {
+			select {
+			case <-terminator:
+			case output <- entry:
+			}
+			return
+		}
+		if err := buffer.append(entry); err != nil {
+			sendBufferError(err)
+			return
+		}
+		if limit > 0 {
+			if err := buffer.dropLeading(limit); err != nil {
+				sendBufferError(err)
+				return
+			}
+		}
+	}
+
+	sent := 0
+	if err := buffer.forEach(true, func(entry *ChangeEntry) bool {
+		if limit > 0 && sent >= limit {
+			return false
+		}
+		select {
+		case <-terminator:
+			return false
+		case output <- entry:
+		}
+		sent++
+		return true
+	}); err != nil {
+		sendBufferError(err)
+	}
+}
+
 func (db *Database) startChangeWaiter(chans base.Set) *ChangeWaiter {
 	waitChans := chans
 	if db.user != nil {
@@ -351,6 +1203,39 @@ func (db *Database) appendUserFeed(feeds []<-chan *ChangeEntry, names []string,
 	return feeds, names
 }
 
+// Blocks a paused feed until a value is received from options.ResumeSignal, returning the time spent paused.  Returns
+// false if the feed is terminated while paused.
+func (db *Database) waitForChangesResume(options ChangesOptions, to string) (time.Duration, bool) {
+	pauseStart := time.Now()
+	base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed paused %s", base.UD(to))
+	select {
+	case <-options.ResumeSignal:
+	case <-options.Terminator:
+		return 0, false
+	}
+	pausedTime := time.Since(pauseStart)
+	base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed resumed after %v %s", pausedTime, base.UD(to))
+	return pausedTime, true
+}
+
+// Returns the added and removed keys of changed.  Either set is nil when there aren't any.
+func splitChangedKeys(changed channels.ChangedKeys) (added, removed base.Set) {
+	for key, isAdded := range changed {
+		if isAdded {
+			if added == nil {
+				added = base.Set{}
+			}
+			added.Add(key)
+		} else {
+			if removed == nil {
+				removed = base.Set{}
+			}
+			removed.Add(key)
+		}
+	}
+	return added, removed
+}
+
 func (db *Database) checkForUserUpdates(userChangeCount uint64, changeWaiter *ChangeWaiter, isContinuous bool) (isChanged bool, newCount uint64, changedChannels channels.ChangedKeys, err error) {
 
 	newCount = changeWaiter.CurrentUserCount()
@@ -374,26 +1259,665 @@ func (db *Database) checkForUserUpdates(userChangeCount uint64, changeWaiter *Ch
 				base.DebugfCtx(db.Ctx, base.KeyChanges, "Modified channel set after user reload: %v", base.UD(changedChannels))
 			}
 
-			changedRoles := db.user.RoleNames().CompareKeys(previousRoles)
-			if len(changedRoles) > 0 {
-				changeWaiter.RefreshUserKeys(db.User())
+			changedRoles := db.user.RoleNames().CompareKeys(previousRoles)
+			if len(changedRoles) > 0 {
+				changeWaiter.RefreshUserKeys(db.User())
+			}
+		}
+		return true, newCount, changedChannels, nil
+	}
+	return false, userChangeCount, nil, nil
+}
+
+// ChangesOrder reports whether entry a should be sent before entry b (see ChangesOptions.Order).  It must be a strict
+// total order over sequences: entries with the same sequence (the same change, found in more than one channel) must
+// be ordered before neither, and all other entries must be ordered consistently and transitively.  It's called by the
+// feed goroutine, with entries that mustn't be modified or retained.
+type ChangesOrder func(a, b *ChangeEntry) bool
+
+// DefaultChangesOrder is the sequence order used when ChangesOptions.Order isn't set.
+func DefaultChangesOrder(a, b *ChangeEntry) bool {
+	return a.Seq.Before(b.Seq)
+}
+
+// changesMerger merges a set of channel feeds into a single feed ordered by sequence.
+type changesMerger struct {
+	feeds              []<-chan *ChangeEntry
+	current            []*ChangeEntry // The next unsent entry for each feed
+	skipFailedChannels bool           // Omit feeds that return an error entry, instead of returning the error
+	failedChannels     base.Set       // Channels of the feeds omitted by skipFailedChannels
+	priority           []bool         // Flags the feeds (by index) whose entries are returned ahead of lower sequences on other feeds, if set
+	order              ChangesOrder   // Selects the entry returned from the feeds' current entries, if set
+	fair               bool           // Return entries from the feeds in turn, instead of in sequence order
+	lastFeed           int            // Index of the feed the last entry was returned from, when fair is set
+	lock               sync.Mutex     // Guards writes to current and feeds, so they can be read by debug snapshots
+}
+
+func newChangesMerger(feeds []<-chan *ChangeEntry) *changesMerger {
+	return &changesMerger{
+		feeds:    feeds,
+		current:  make([]*ChangeEntry, len(feeds)),
+		lastFeed: -1,
+	}
+}
+
+// Returns the entry with the minimum sequence across all feeds, or nil once all feeds are closed.  When the same
+// sequence is available on more than one feed, the Removed, BackfillComplete and Channels of the matching entries are
+// unioned onto the returned entry.  If a feed returns an error entry, that entry is returned immediately, unless
+// skipFailedChannels is set - then the feed is omitted, and its channel added to failedChannels.
+//
+// When priority is set, the minimum entry across the priority feeds is returned ahead of any lower sequence on the
+// other feeds, so ordering is priority-then-sequence.  The entry's priorityLowSeq is set to the sequence preceding the
+// lowest sequence it was returned ahead of, to be sent as its low sequence - resuming from the entry then resends the
+// skipped sequences (and the priority entries following them), instead of losing them.  Backfilled entries are never
+// reordered, as the triggering sequence can't be combined with a low sequence to resume both channels.
+//
+// When order is set, it selects the entry returned instead, from the current entry of each feed.  Entries returned ahead
+// of a lower sequence are given a priorityLowSeq in the same way, so resuming from any entry is still safe, and
+// backfilled entries are still returned in sequence order.
+//
+// When fair is set, the feeds take turns instead - each entry is returned from the next feed (after the feed the last
+// entry was returned from) that has a current entry, so a high-volume channel can't crowd the other channels out of a
+// Limit.  Entries returned ahead of a lower sequence are given a priorityLowSeq, and backfilled entries are returned in
+// sequence order, as for order.  This trades sequence order for fairness - the feed is still resumable, but resuming
+// may resend entries.
+func (m *changesMerger) next() *ChangeEntry {
+	// Read more entries to fill up the current[] array.  The lock isn't held while waiting on a feed, so that debug
+	// snapshots aren't blocked by a slow feed.
+	for i, cur := range m.current {
+		if cur == nil && m.feeds[i] != nil {
+			entry, ok := <-m.feeds[i]
+			m.lock.Lock()
+			if !ok {
+				m.feeds[i] = nil
+			} else if entry.Err == base.ErrChannelFeed && m.skipFailedChannels {
+				// The feed is closed after an error, so doesn't need to be read any further
+				m.failedChannels = m.failedChannels.Union(entry.FailedChannels)
+				m.feeds[i] = nil
+			} else {
+				m.current[i] = entry
+			}
+			m.lock.Unlock()
+			if ok && entry.Err == base.ErrChannelFeed && !m.skipFailedChannels {
+				return entry
+			}
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// Find the current entry with the minimum sequence:
+	minSeq := MaxSequenceID
+	var minEntry *ChangeEntry
+	minIndex := -1
+	for i, cur := range m.current {
+		if cur != nil && cur.Seq.Before(minSeq) {
+			minSeq = cur.Seq
+			minEntry = cur
+			minIndex = i
+		}
+	}
+
+	if minEntry == nil {
+		return nil
+	}
+
+	if m.fair {
+		if minEntry.Seq.TriggeredBy == 0 && minEntry.Seq.SafeSequence() > 1 {
+			for offset := 1; offset <= len(m.current); offset++ {
+				i := (m.lastFeed + offset) % len(m.current)
+				if cur := m.current[i]; cur != nil && cur.Seq.TriggeredBy == 0 {
+					if cur.Seq != minSeq {
+						cur.priorityLowSeq = minEntry.Seq.SafeSequence() - 1
+						minSeq = cur.Seq
+						minEntry = cur
+					}
+					minIndex = i
+					break
+				}
+			}
+		}
+		m.lastFeed = minIndex
+	}
+
+	if m.order != nil && minEntry.Seq.TriggeredBy == 0 && minEntry.Seq.SafeSequence() > 1 {
+		var orderedEntry *ChangeEntry
+		for _, cur := range m.current {
+			if cur != nil && (orderedEntry == nil || m.order(cur, orderedEntry)) {
+				orderedEntry = cur
+			}
+		}
+		if orderedEntry.Seq != minSeq && orderedEntry.Seq.TriggeredBy == 0 {
+			orderedEntry.priorityLowSeq = minEntry.Seq.SafeSequence() - 1
+			minSeq = orderedEntry.Seq
+			minEntry = orderedEntry
+		}
+	}
+
+	if m.priority != nil && minEntry.Seq.TriggeredBy == 0 && minEntry.Seq.SafeSequence() > 1 {
+		var priorityEntry *ChangeEntry
+		for i, cur := range m.current {
+			if cur != nil && i < len(m.priority) && m.priority[i] && cur.Seq.TriggeredBy == 0 && (priorityEntry == nil || cur.Seq.Before(priorityEntry.Seq)) {
+				priorityEntry = cur
+			}
+		}
+		if priorityEntry != nil && priorityEntry.Seq != minSeq {
+			priorityEntry.priorityLowSeq = minEntry.Seq.SafeSequence() - 1
+			minSeq = priorityEntry.Seq
+			minEntry = priorityEntry
+		}
+	}
+
+	// Clear the current entries for the sequence being returned:
+	if minEntry.Removed != nil {
+		minEntry.allRemoved = true
+	}
+	for i, cur := range m.current {
+		if cur != nil && cur.Seq == minSeq {
+			m.current[i] = nil
+			// Track whether this is a removal from all user's channels
+			if cur.Removed == nil && minEntry.allRemoved == true {
+				minEntry.allRemoved = false
+			}
+			// Also concatenate the matching entries' Removed arrays:
+			if cur != minEntry && cur.Removed != nil {
+				if minEntry.Removed == nil {
+					minEntry.Removed = cur.Removed
+				} else {
+					minEntry.Removed = minEntry.Removed.Union(cur.Removed)
+				}
+				minEntry.addRemovalReasons(cur.RemovalReasons)
+			}
+			if cur != minEntry && cur.Channels != nil {
+				minEntry.Channels = unionChannelNames(minEntry.Channels, cur.Channels)
+			}
+			// Backfill markers for the same triggering sequence are combined into a single marker
+			if cur != minEntry && cur.BackfillComplete != nil && minEntry.BackfillComplete != nil {
+				minEntry.BackfillComplete = minEntry.BackfillComplete.Union(cur.BackfillComplete)
+			}
+			// The matching entry has been merged into minEntry and is no longer needed
+			if cur != minEntry {
+				returnChangeEntry(cur)
+			}
+		}
+	}
+	return minEntry
+}
+
+// Returns the sorted union of two lists of channel names.
+func unionChannelNames(a, b []string) []string {
+	union := base.SetFromArray(a).Union(base.SetFromArray(b)).ToArray()
+	sort.Strings(union)
+	return union
+}
+
+// Returns the state of the merger's feeds, labelled with names (indexed as the feeds).  Safe to call while another
+// goroutine is calling next.
+func (m *changesMerger) debugState(names []string) []ChannelFeedDebugState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	states := make([]ChannelFeedDebugState, len(m.feeds))
+	for i, cur := range m.current {
+		if i < len(names) {
+			states[i].Channel = names[i]
+		}
+		states[i].Open = m.feeds[i] != nil
+		if cur != nil {
+			seq := cur.Seq
+			states[i].Current = &seq
+			states[i].CurrentDocID = cur.ID
+		}
+	}
+	return states
+}
+
+// Returns the number of entries that have been read (or are buffered) by the merger's feeds but not yet returned
+// by next.  Entries the feeds haven't yet fetched aren't included.
+func (m *changesMerger) pending() int {
+	count := 0
+	for i, cur := range m.current {
+		if cur != nil {
+			count++
+		}
+		if m.feeds[i] != nil {
+			count += len(m.feeds[i])
+		}
+	}
+	return count
+}
+
+// Drains the merger, retaining only the highest sequence entry for each doc ID.  Retained entries are returned in
+// merged order.  Draining stops at the first feed error, which is returned as the final entry.
+func coalesceLatestEntries(merger *changesMerger) []*ChangeEntry {
+	var entries []*ChangeEntry
+	latestIndex := make(map[string]int)
+	for {
+		entry := merger.next()
+		if entry == nil {
+			break
+		}
+		if entry.Err != nil {
+			entries = append(entries, entry)
+			break
+		}
+		if entry.BackfillComplete != nil {
+			entries = append(entries, entry)
+			continue
+		}
+		if index, ok := latestIndex[entry.ID]; ok {
+			if entries[index].Seq.Seq >= entry.Seq.Seq {
+				continue
+			}
+			entries[index] = nil
+		}
+		latestIndex[entry.ID] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	coalesced := entries[:0]
+	for _, entry := range entries {
+		if entry != nil {
+			coalesced = append(coalesced, entry)
+		}
+	}
+	return coalesced
+}
+
+// unorderedChangesSource forwards the entries of a set of channel feeds as they arrive, instead of ordering them by
+// sequence like changesMerger (see ChangesOptions.Unordered).  An entry found in more than one feed is only returned
+// once.  Removal entries are held back until the feeds are done, and dropped if the doc is still visible through another
+// feed - the entry returned for that feed is given the union of the held Removed sets.  Unlike changesMerger, other
+// per-feed fields of duplicate entries (e.g. Channels) aren't unioned, and failed channels aren't skipped.
+//
+// As entries aren't ordered, their sequences aren't resumable checkpoints, and clients must handle out-of-order
+// delivery.  Instead, the feed ends each iteration that sent entries with a checkpoint entry, whose Seq is resumable.
+type unorderedChangesSource struct {
+	entries  chan *ChangeEntry
+	returned map[SequenceID]struct{}
+	removals map[SequenceID]*ChangeEntry // Held removal entries, by sequence
+	held     []SequenceID                // Sequences of the held removal entries, in arrival order
+}
+
+// Starts a goroutine per feed forwarding its entries, until the feed is done or terminator is closed.
+func newUnorderedChangesSource(feeds []<-chan *ChangeEntry, terminator chan bool) *unorderedChangesSource {
+	source := &unorderedChangesSource{
+		entries:  make(chan *ChangeEntry, len(feeds)),
+		returned: make(map[SequenceID]struct{}),
+		removals: make(map[SequenceID]*ChangeEntry),
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(feeds))
+	for _, feed := range feeds {
+		go func(feed <-chan *ChangeEntry) {
+			defer wg.Done()
+			for entry := range feed {
+				select {
+				case <-terminator:
+					return
+				case source.entries <- entry:
+				}
+			}
+		}(feed)
+	}
+	go func() {
+		wg.Wait()
+		close(source.entries)
+	}()
+	return source
+}
+
+// Returns the next entry to arrive from any feed, or nil once all the feeds are done and the held removals returned.
+func (s *unorderedChangesSource) next() *ChangeEntry {
+	for entry := range s.entries {
+		// Errors and marker entries (not associated with a doc) aren't deduplicated
+		if entry.Err != nil || entry.ID == "" {
+			return entry
+		}
+		if _, ok := s.returned[entry.Seq]; ok {
+			continue
+		}
+		if entry.Removed != nil {
+			if held, ok := s.removals[entry.Seq]; ok {
+				held.Removed = held.Removed.Union(entry.Removed)
+				held.addRemovalReasons(entry.RemovalReasons)
+			} else {
+				s.removals[entry.Seq] = entry
+				s.held = append(s.held, entry.Seq)
+			}
+			continue
+		}
+		if held, ok := s.removals[entry.Seq]; ok {
+			entry.Removed = held.Removed
+			entry.RemovalReasons = held.RemovalReasons
+			delete(s.removals, entry.Seq)
+		}
+		s.returned[entry.Seq] = struct{}{}
+		return entry
+	}
+
+	// The feeds are done - the remaining held entries are removals in all the feeds they were found in
+	for len(s.held) > 0 {
+		seq := s.held[0]
+		s.held = s.held[1:]
+		if entry, ok := s.removals[seq]; ok {
+			delete(s.removals, seq)
+			entry.allRemoved = true
+			return entry
+		}
+	}
+	return nil
+}
+
+// Returns the number of entries already read from the feeds, but not yet returned.
+func (s *unorderedChangesSource) pending() int {
+	return len(s.entries) + len(s.removals)
+}
+
+// Returns a function that returns the given entries in turn, followed by nil.
+func changeEntrySliceSource(entries []*ChangeEntry) func() *ChangeEntry {
+	return func() *ChangeEntry {
+		if len(entries) == 0 {
+			return nil
+		}
+		entry := entries[0]
+		entries = entries[1:]
+		return entry
+	}
+}
+
+// Logs a key changes feed event (see base.LogEventCtx), adding the feed's user to the event fields.
+func (db *Database) logChangesEvent(logLevel base.LogLevel, event string, fields map[string]interface{}, format string, args ...interface{}) {
+	if db.user != nil {
+		fields["user"] = base.UD(db.user.Name())
+	}
+	base.LogEventCtx(db.Ctx, logLevel, base.KeyChanges, event, fields, format, args...)
+}
+
+// Returns a copy of the database whose log context correlation ID is extended with an ID for the changes feed (the
+// leading part of the feed's listener ID), so that log lines for concurrent feeds started by the same request or BLIP
+// connection can be told apart.
+func (db *Database) changesFeedLoggingCopy(listenerID string) *Database {
+	parentCtx := db.Ctx
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	logCtx, _ := parentCtx.Value(base.LogContextKey{}).(base.LogContext)
+
+	feedID := "changes-" + listenerID
+	if len(listenerID) > 8 {
+		feedID = "changes-" + listenerID[:8]
+	}
+	if logCtx.CorrelationID != "" {
+		logCtx.CorrelationID += "-" + feedID
+	} else {
+		logCtx.CorrelationID = feedID
+	}
+
+	feedDB := *db
+	feedDB.Ctx = context.WithValue(parentCtx, base.LogContextKey{}, logCtx)
+	return &feedDB
+}
+
+// Maximum length of a channel pattern accepted by CompileChannelPattern
+const maxChannelPatternLength = 256
+
+// Compiles a pattern for use as ChangesOptions.ChannelPattern.  The pattern must match the entire channel name, and
+// can use (?i) for case-insensitive matching.  Go regular expressions guarantee matching in time linear in the
+// length of the channel name, so bounding the pattern length is sufficient to bound the cost of expansion.
+func CompileChannelPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Empty channel pattern")
+	}
+	if len(pattern) > maxChannelPatternLength {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Channel pattern exceeds maximum length of %d", maxChannelPatternLength)
+	}
+	channelPattern, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Invalid channel pattern: %v", err)
+	}
+	return channelPattern, nil
+}
+
+// Restricts chans to the channels available to the user, expanding the wildcard and options.ChannelPattern, and
+// finds since when these channels have been available to the user.  With a ChannelNormalizer, chans and the pattern
+// are matched against the user's normalized channel names (see normalizeRequestedChannels).
+func (db *Database) filterToAvailableChannels(chans base.Set, options ChangesOptions) channels.TimedSet {
+	chans = db.normalizeRequestedChannels(chans)
+	if db.user == nil {
+		return channels.AtSequence(chans, 0)
+	}
+	channelsSince := db.user.FilterToAvailableChannels(chans)
+	if options.ChannelPattern != nil {
+		for channel, vbSeq := range db.user.InheritedChannels() {
+			if options.ChannelPattern.MatchString(db.normalizeChannel(channel)) {
+				channelsSince.AddChannel(channel, vbSeq.Sequence)
+			}
+		}
+	}
+	return channelsSince
+}
+
+// Returns the channel name normalized by the database's ChannelNormalizer, if set.
+func (db *Database) normalizeChannel(channel string) string {
+	if db.ChannelNormalizer == nil {
+		return channel
+	}
+	return db.ChannelNormalizer(channel)
+}
+
+// Replaces each requested channel with the user's channels whose normalized names match its normalized name, or with
+// its normalized name when there are none (or there's no user), so that a feed for "tenant42" sees a "Tenant42" grant
+// when the normalizer lowercases.  Channel caches are keyed by the names docs were assigned to, so the user's names
+// are kept.  Returns chans unchanged when there's no ChannelNormalizer.
+func (db *Database) normalizeRequestedChannels(chans base.Set) base.Set {
+	if db.ChannelNormalizer == nil {
+		return chans
+	}
+	userChannels := make(map[string][]string)
+	if db.user != nil {
+		for channel := range db.user.InheritedChannels() {
+			normalized := db.ChannelNormalizer(channel)
+			userChannels[normalized] = append(userChannels[normalized], channel)
+		}
+	}
+	result := make(base.Set, len(chans))
+	for channel := range chans {
+		if channel == channels.AllChannelWildcard {
+			result[channel] = struct{}{}
+			continue
+		}
+		normalized := db.ChannelNormalizer(channel)
+		matches, ok := userChannels[normalized]
+		if !ok {
+			matches = []string{normalized}
+		}
+		for _, match := range matches {
+			result[match] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Returns an error if since isn't a position the database has reached - e.g. a client checkpoint from before the
+// database was restored from a backup, which would otherwise silently return no changes until the database's
+// sequences catch up with it.
+func (db *Database) ValidateSince(since SequenceID) error {
+	if since.LowSeq > since.Seq {
+		return base.HTTPErrorf(http.StatusBadRequest, "Since low sequence %d is after its sequence %d", since.LowSeq, since.Seq)
+	}
+	lastSequence, err := db.LastSequence()
+	if err != nil {
+		return err
+	}
+	if since.Seq > lastSequence || since.TriggeredBy > lastSequence {
+		return base.HTTPErrorf(http.StatusBadRequest, "Since %s is ahead of the database's last sequence %d", since, lastSequence)
+	}
+	return nil
+}
+
+// Returns the number of entries in channel that a feed for the user starting at since would send as backfill, because
+// the channel was granted after since, without streaming them - e.g. to show the progress of an initial sync.  Entries
+// are counted from the channel cache, which only queries for ranges that aren't cached.  Backfill boundaries match the
+// feed's: entries before the grant's sequence are counted, from since.Seq when resuming a backfill triggered by the
+// grant, and none when since is resuming the backfill of a later grant.  Admin feeds don't backfill, so always return
+// zero.
+func (db *Database) BackfillEntryCount(channel string, since SequenceID) (int, error) {
+	if db.user == nil {
+		return 0, nil
+	}
+	seqAddedAt := db.user.CanSeeChannelSince(channel)
+	if seqAddedAt <= 1 || !since.Before(SequenceID{Seq: seqAddedAt}) {
+		return 0, nil
+	}
+
+	var startSeq uint64
+	if since.TriggeredBy == seqAddedAt {
+		startSeq = since.Seq
+	} else if since.TriggeredBy > seqAddedAt {
+		return 0, nil
+	}
+
+	singleChannelCache := db.changeCache.getChannelCache().getSingleChannelCache(channel)
+	queryLimit := db.Options.CacheOptions.ChannelQueryLimit
+	count := 0
+	for {
+		entries, err := db.getChannelChangesWithRetry(singleChannelCache, ChangesOptions{Since: SequenceID{Seq: startSeq}, Limit: queryLimit})
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			if entry.Sequence >= seqAddedAt {
+				return count, nil
 			}
+			count++
 		}
-		return true, newCount, changedChannels, nil
+		if len(entries) < queryLimit {
+			return count, nil
+		}
+		startSeq = entries[len(entries)-1].Sequence
 	}
-	return false, userChangeCount, nil, nil
 }
 
-// Returns the (ordered) union of all of the changes made to multiple channels.
-func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOptions) (<-chan *ChangeEntry, error) {
+// Returns informational entries, in channel name order, for the requested channels that aren't in available and haven't
+// already been reported.  The "*" wildcard is never omitted.
+func inaccessibleChannelEntries(requested base.Set, available channels.TimedSet, reported base.Set, since SequenceID) []*ChangeEntry {
+	names := requested.ToArray()
+	sort.Strings(names)
+	var entries []*ChangeEntry
+	for _, channel := range names {
+		if channel == channels.AllChannelWildcard || reported.Contains(channel) {
+			continue
+		}
+		if _, ok := available[channel]; ok {
+			continue
+		}
+		reason := InaccessibleReasonNoAccess
+		if !channels.IsValidChannel(channel) {
+			reason = InaccessibleReasonInvalid
+		}
+		entries = append(entries, &ChangeEntry{
+			Seq:                 since,
+			Changes:             []ChangeRev{},
+			InaccessibleChannel: channel,
+			InaccessibleReason:  reason,
+		})
+	}
+	return entries
+}
+
+// Returns the (ordered) union of all of the changes made to multiple channels, and the ID of the feed in
+// ActiveChangeListeners.
+func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOptions) (<-chan *ChangeEntry, string, error) {
 
 	to := ""
+	var userName string
 	if db.user != nil && db.user.Name() != "" {
-		to = fmt.Sprintf("  (to %s)", db.user.Name())
+		userName = db.user.Name()
+		to = fmt.Sprintf("  (to %s)", userName)
 	}
 
-	base.InfofCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed(channels: %s, options: %s) ... %s", base.UD(chans), options, base.UD(to))
+	// Guest feeds don't include the guest user doc, and don't check for guest user updates.  Changes to the guest
+	// user's channels are picked up by subsequent feeds.
+	isGuest := db.user != nil && db.user.Name() == ""
+
+	// Register the feed, so that it's included in ActiveChangeListeners and can be cancelled with CancelChangeListener.
+	// Feed processing uses an internal terminator, closed when the caller's terminator is closed, the feed is
+	// cancelled, options.MaxDuration or options.IdleTimeout has elapsed, or the feed exits.
+	debugState := &changesFeedDebugState{}
+	listenerID, cancelled, activity := db.changeListeners.register(userName, chans, options, debugState)
+
+	// Feed processing logs with a correlation ID identifying the feed
+	db = db.changesFeedLoggingCopy(listenerID)
+	options.Ctx = db.Ctx
+
+	db.logChangesEvent(base.LevelInfo, "feed_start", map[string]interface{}{"channels": base.UD(chans), "seq": options.Since.String(), "continuous": options.Continuous},
+		"MultiChangesFeed(channels: %s, options: %s) ... %s", base.UD(chans), options, base.UD(to))
 	output := make(chan *ChangeEntry, 50)
+	feedStartTime := time.Now()
+
+	// Tracing is skipped entirely when there's no tracer
+	var span ChangesSpan
+	if options.Tracer != nil {
+		span = options.Tracer.StartFeedSpan(db.Ctx, listenerID)
+	}
+
+	callerTerminator := options.Terminator
+	terminator := make(chan bool)
+	options.Terminator = terminator
+	feedDone := make(chan struct{})
+	var maxDuration <-chan time.Time
+	var maxDurationTimer *time.Timer
+	if options.MaxDuration > 0 {
+		maxDurationTimer = time.NewTimer(options.MaxDuration)
+		maxDuration = maxDurationTimer.C
+	}
+	// The idle timeout reclaims the feeds of clients that vanished without terminating them
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if options.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(options.IdleTimeout)
+		idle = idleTimer.C
+	}
+	go func() {
+		if maxDurationTimer != nil {
+			defer maxDurationTimer.Stop()
+		}
+		if idleTimer != nil {
+			defer idleTimer.Stop()
+		}
+		for {
+			select {
+			case <-callerTerminator:
+				close(terminator)
+			case <-cancelled:
+				base.InfofCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed cancelled %s", base.UD(to))
+				close(terminator)
+				// Wake the feed if it's waiting for changes, so that it notices termination
+				db.NotifyTerminatedChanges(userName)
+			case <-maxDuration:
+				base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed reached max duration %v %s", options.MaxDuration, base.UD(to))
+				close(terminator)
+				db.NotifyTerminatedChanges(userName)
+			case <-activity:
+				if idleTimer != nil {
+					if !idleTimer.Stop() {
+						<-idleTimer.C
+					}
+					idleTimer.Reset(options.IdleTimeout)
+				}
+				continue
+			case <-idle:
+				base.InfofCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed idle for %v - terminating changes feed %s", options.IdleTimeout, base.UD(to))
+				db.DbStats.ChangesFeed().IdleFeedsReclaimed.Add(1)
+				close(terminator)
+				db.NotifyTerminatedChanges(userName)
+			case <-feedDone:
+				close(terminator)
+			}
+			return
+		}
+	}()
 
 	go func() {
 
@@ -401,10 +1925,42 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			if panicked := recover(); panicked != nil {
 				base.WarnfCtx(db.Ctx, "[%s] Unexpected panic sending changes - terminating changes: \n %s", panicked, debug.Stack())
 			} else {
-				base.InfofCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed done %s", base.UD(to))
+				db.logChangesEvent(base.LevelInfo, "terminate", map[string]interface{}{}, "MultiChangesFeed done %s", base.UD(to))
+			}
+			if span != nil {
+				span.End()
 			}
 			close(output)
 		}()
+		defer close(feedDone)
+		defer db.changeListeners.deregister(listenerID)
+
+		if !db.acquireChangesFeedSlot(options.Terminator) {
+			// A feed terminated while waiting for a slot just closes
+			select {
+			case <-options.Terminator:
+				return
+			default:
+			}
+			base.WarnfCtx(db.Ctx, "MultiChangesFeed unable to start - %d changes feeds already active %s", db.Options.ChangesFeedOptions.MaxConcurrentFeeds, base.UD(to))
+			db.DbStats.ChangesFeed().NumFeedsRejected.Add(1)
+			change := makeErrorEntry("Too many active changes feeds - terminating changes feed")
+			output <- &change
+			return
+		}
+		defer db.releaseChangesFeedSlot()
+
+		db.DbStats.ChangesFeed().NumActiveFeeds.Add(1)
+		defer db.DbStats.ChangesFeed().NumActiveFeeds.Add(-1)
+
+		reportedInaccessible := base.Set{} // Channels reported by ReportInaccessibleChannels
+
+		// Goroutines are tracked for this one, plus those started for the channel feeds of the current iteration
+		var iterationGoroutines int
+		db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Add(1)
+		defer func() {
+			db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Add(-int64(1 + iterationGoroutines))
+		}()
 
 		var changeWaiter *ChangeWaiter
 		var lowSequence uint64
@@ -414,9 +1970,53 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 		var changedChannels map[string]bool // Tracks channels added/removed to the user during changes processing.
 		var userChanged bool                // Whether the user document has changed in a given iteration loop
 		var deferredBackfill bool           // Whether there's a backfill identified in the user doc that's deferred while the SG cache catches up
+		var draining bool                   // Whether the feed has been terminated and is flushing already-merged entries (DrainOnTerminate)
+		var wokenUp bool                    // Whether the current iteration was triggered by a ChangeWaiter notification
+		var firstEntrySent bool             // Whether time to first entry has been recorded for this feed
+		var inBackfill bool                 // Whether the feed is currently counted in NumFeedsInBackfill
+		var channelsFailed bool             // Whether channels were omitted from the last iteration after errors reading them
+
+		setInBackfill := func(backfilling bool) {
+			if backfilling == inBackfill {
+				return
+			}
+			inBackfill = backfilling
+			if backfilling {
+				db.DbStats.ChangesFeed().NumFeedsInBackfill.Add(1)
+			} else {
+				db.DbStats.ChangesFeed().NumFeedsInBackfill.Add(-1)
+			}
+			if span != nil {
+				event := "backfill_end"
+				if backfilling {
+					event = "backfill_start"
+				}
+				span.AddEvent(event, map[string]interface{}{"seq": options.Since.String()})
+			}
+		}
+		defer setInBackfill(false)
 
 		// Retrieve the current max cached sequence - ensures there isn't a race between the subsequent channel cache queries
 		currentCachedSequence = db.changeCache.getChannelCache().GetHighCacheSequence()
+
+		// Channels granted before the current sequence are treated as already sent, so aren't backfilled
+		if options.SinceNow {
+			if options.Since != (SequenceID{}) {
+				change := makeErrorEntry("Since can't be specified with SinceNow - terminating changes feed")
+				output <- &change
+				return
+			}
+			options.Since = SequenceID{Seq: currentCachedSequence}
+		}
+
+		if options.ValidateSince {
+			if err := db.ValidateSince(options.Since); err != nil {
+				change := makeErrorEntry(fmt.Sprintf("%v - terminating changes feed", err))
+				output <- &change
+				return
+			}
+		}
+
 		if options.Wait {
 			options.Wait = false
 			changeWaiter = db.startChangeWaiter(base.Set{}) // Waiter is updated with the actual channel set (post-user reload) at the start of the outer changes loop
@@ -424,7 +2024,7 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			// Reload user to pick up user changes that happened between auth and the change waiter
 			// initialization.  Without this, notification for user doc changes in that window (a) won't be
 			// included in the initial changes loop iteration, and (b) won't wake up the ChangeWaiter.
-			if db.user != nil {
+			if db.user != nil && !isGuest {
 				if err := db.ReloadUser(); err != nil {
 					base.WarnfCtx(db.Ctx, "Error reloading user during changes initialization %q: %v", base.UD(db.user.Name()), err)
 					change := makeErrorEntry("User not found during reload - terminating changes feed")
@@ -437,16 +2037,35 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 
 		// Restrict to available channels, expand wild-card, and find since when these channels
 		// have been available to the user:
-		var channelsSince channels.TimedSet
-		if db.user != nil {
-			channelsSince = db.user.FilterToAvailableChannels(chans)
-		} else {
-			channelsSince = channels.AtSequence(chans, 0)
+		channelsSince := db.filterToAvailableChannels(chans, options)
+
+		// Let the consumer know about requested channels that were omitted, once per channel
+		if options.ReportInaccessibleChannels && db.user != nil {
+			for _, entry := range inaccessibleChannelEntries(db.normalizeRequestedChannels(chans), channelsSince, reportedInaccessible, options.Since) {
+				select {
+				case <-options.Terminator:
+					return
+				case output <- entry:
+				}
+				reportedInaccessible.Add(entry.InaccessibleChannel)
+			}
+		}
+
+		// The number of available channels drives the number of channel feeds started for each iteration
+		db.DbStats.ChangesFeed().ExpandedChannelsCount.Add(int64(len(channelsSince)))
+		db.DbStats.ChangesFeed().ExpandedChannelsMax.SetIfMax(int64(len(channelsSince)))
+		thresholds := db.Options.ChangesFeedOptions.Thresholds
+		if threshold := changesFeedThreshold(thresholds.ExpandedChannels, DefaultExpandedChannelsWarningThreshold); threshold >= 0 && len(channelsSince) > threshold {
+			base.InfofCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed channels expand to %d channels, above the threshold of %d - consider granting fewer, larger channels %s", len(channelsSince), threshold, base.UD(to))
 		}
+		backfillWarningThreshold := changesFeedThreshold(thresholds.BackfillEntries, DefaultBackfillEntriesWarningThreshold)
+		wakeupsWarningThreshold := changesFeedThreshold(thresholds.UnproductiveWakeups, DefaultUnproductiveWakeupsWarningThreshold)
+		var backfillEntriesSent, unproductiveWakeups int
 
 		// Mark channel set as active, schedule defer
 		db.activeChannels.IncrChannels(channelsSince)
 		defer db.activeChannels.DecrChannels(channelsSince)
+		db.changeListeners.update(listenerID, channelsSince.AsSet(), options.Since)
 
 		// For a continuous feed, initialise the lateSequenceFeeds that track late-arriving sequences
 		// to the channel caches.
@@ -455,19 +2074,73 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			defer db.closeLateFeeds(lateSequenceFeeds)
 		}
 
+		// Unlike DocIDChangesFeed, DocIDs filters the merged feed of the usual channels, so supports continuous feeds
+		var docIDFilter base.Set
+		if len(options.DocIDs) > 0 {
+			docIDFilter = base.SetFromArray(options.DocIDs)
+		}
+
 		// Store incoming low sequence, for potential use by longpoll iterations
 		requestLowSeq := options.Since.LowSeq
 		// Last sent low sequence is needed for continuous replications that need to reset their late sequence feed (e.g.
 		// due to cache compaction)
 		lastSentLowSeq := options.Since.LowSeq
 
+		// Time spent running changes iterations, and the portion of it spent blocked on the consumer accepting entries.
+		// A high ratio identifies slow consumers.
+		var activeTime, sendBlockedTime time.Duration
+
+		var entriesSent, wakeups uint64
+		// Stats entries are sent between other entries and on wakeup, so are delayed while the feed waits for changes
+		var statsDue <-chan time.Time
+		if options.Continuous && options.StatsInterval > 0 {
+			statsTicker := time.NewTicker(options.StatsInterval)
+			defer statsTicker.Stop()
+			statsDue = statsTicker.C
+		}
+		// Sends a stats entry if one is due.  Returns false if the feed was terminated.
+		sendFeedStats := func() bool {
+			select {
+			case <-statsDue:
+			default:
+				return true
+			}
+			entry := &ChangeEntry{
+				Seq:     options.Since,
+				Changes: []ChangeRev{},
+				FeedStats: &ChangesFeedProgress{
+					EntriesSent: entriesSent,
+					Wakeups:     wakeups,
+					InBackfill:  inBackfill,
+				},
+			}
+			select {
+			case <-options.Terminator:
+				return false
+			case output <- entry:
+			}
+			return true
+		}
+
 		// This loop is used to re-run the fetch after every database change, in Wait mode
 	outer:
 		for {
+			iterationStart := time.Now()
+			if span != nil {
+				span.AddEvent("iteration", map[string]interface{}{"since": options.Since.String(), "woken_up": wokenUp})
+			}
+			if !sendFeedStats() {
+				return
+			}
 
-			// Updates the ChangeWaiter to the current set of available channels
+			// Updates the ChangeWaiter to the current set of available channels.  Access change only feeds don't need to
+			// be woken by doc changes - the waiter is still notified of user changes.
 			if changeWaiter != nil {
-				changeWaiter.UpdateChannels(channelsSince)
+				if options.AccessChangesOnly {
+					changeWaiter.UpdateChannels(nil)
+				} else {
+					changeWaiter.UpdateChannels(channelsSince)
+				}
 			}
 			base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed: channels expand to %#v ... %s", base.UD(channelsSince.String()), base.UD(to))
 
@@ -492,6 +2165,7 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			// Populate the parallel arrays of channels and names:
 			feeds := make([]<-chan *ChangeEntry, 0, len(channelsSince))
 			names := make([]string, 0, len(channelsSince))
+			var priorityFeeds []bool // Parallel to feeds when PriorityChannels is set.  The user feed isn't a priority feed.
 
 			// Get read lock for late-arriving sequences, to avoid sending the same late arrival in
 			// two different changes iterations.  e.g. without the RLock, a late-arriving sequence
@@ -499,12 +2173,19 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			// with access to both channels would see two versions on the feed.
 
 			deferredBackfill = false
-			for name, vbSeqAddedAt := range channelsSince {
+			backfillStarted := false
+			feedChannels := channelsSince
+			if options.AccessChangesOnly {
+				// Only the user feed is needed
+				feedChannels = nil
+			}
+			for name, vbSeqAddedAt := range feedChannels {
 				chanOpts := options
 
 				// Obtain a SingleChannelCache instance to use for both normal and late feeds.  Required to ensure consistency
 				// if cache is evicted during processing
 				singleChannelCache := db.changeCache.getChannelCache().getSingleChannelCache(name)
+				isPriority := options.PriorityChannels != nil && base.ContainsString(options.PriorityChannels, name)
 
 				// Set up late sequence handling first, as we need to roll back the regular feed on error
 				// Handles previously skipped sequences prior to options.Since that
@@ -513,7 +2194,7 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 				if options.Continuous {
 					lateSequenceFeedHandler := lateSequenceFeeds[name]
 					if lateSequenceFeedHandler != nil {
-						latefeed, err := db.getLateFeed(lateSequenceFeedHandler, singleChannelCache)
+						latefeed, err := db.getLateFeed(lateSequenceFeedHandler, singleChannelCache, options)
 						if err != nil {
 							base.WarnfCtx(db.Ctx, "MultiChangesFeed got error reading late sequence feed %q, rolling back channel changes feed to last sent low sequence #%d.", base.UD(name), lastSentLowSeq)
 							chanOpts.Since.LowSeq = lastSentLowSeq
@@ -526,6 +2207,9 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 							lateSequenceFeedHandler.active = true
 							feeds = append(feeds, latefeed)
 							names = append(names, fmt.Sprintf("late_%s", name))
+							if options.PriorityChannels != nil {
+								priorityFeeds = append(priorityFeeds, isPriority)
+							}
 						}
 					} else {
 						// Initialize lateSequenceFeeds[name] for next iteration
@@ -568,24 +2252,82 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 
 				backfillInOtherChannel := options.Since.TriggeredBy != 0 && options.Since.TriggeredBy > seqAddedAt
 
-				if isNewChannel || (backfillRequired && backfillPending) {
+				// A newly added channel whose backfill is already in progress (case 1) resumes from options.Since -
+				// restarting from zero would resend backfilled entries the client already has.
+				newChannelBackfillPending := isNewChannel && options.Since.TriggeredBy != seqAddedAt
+
+				if newChannelBackfillPending || (backfillRequired && backfillPending) {
 					// Newly added channel so initiate backfill:
+					db.logChangesEvent(base.LevelDebug, "backfill_start", map[string]interface{}{"channel": base.UD(name), "seq": seqAddedAt},
+						"MultiChangesFeed starting backfill of channel %s triggered by %d %s", base.UD(name), seqAddedAt, base.UD(to))
 					chanOpts.Since = SequenceID{Seq: 0, TriggeredBy: seqAddedAt}
-				} else if backfillInOtherChannel {
-					chanOpts.Since = SequenceID{Seq: options.Since.TriggeredBy}
+					backfillStarted = true
+					db.DbStats.ChangesFeed().BackfillNewCount.Add(1)
+				} else if options.Since.TriggeredBy != 0 && options.Since.TriggeredBy == seqAddedAt {
+					// Resuming the backfill for this channel from options.Since
+					db.DbStats.ChangesFeed().BackfillInProgressCount.Add(1)
+				} else {
+					if backfillInOtherChannel {
+						chanOpts.Since = SequenceID{Seq: options.Since.TriggeredBy}
+					}
+					db.DbStats.ChangesFeed().BackfillNoneCount.Add(1)
 				}
 
 				feed := db.changesFeed(singleChannelCache, chanOpts, to)
 				feeds = append(feeds, feed)
 				names = append(names, name)
+				if options.PriorityChannels != nil {
+					priorityFeeds = append(priorityFeeds, isPriority)
+				}
 
 			}
+
+			// The feed is in backfill while a backfill started in this iteration, or a previous one, is in progress
+			setInBackfill(backfillStarted || options.Since.TriggeredBy != 0)
+
+			// Each channel feed runs in its own goroutine.  The user feed doesn't, so is excluded.
+			iterationGoroutines = len(feeds)
+
 			// If the user object has changed, create a special pseudo-feed for it:
-			if db.user != nil {
+			if db.user != nil && !isGuest {
 				feeds, names = db.appendUserFeed(feeds, names, options)
 			}
 
-			current := make([]*ChangeEntry, len(feeds))
+			merger := newChangesMerger(feeds)
+			merger.skipFailedChannels = options.SkipFailedChannels
+			merger.priority = priorityFeeds
+			merger.order = options.Order
+			merger.fair = options.FairScheduling
+			debugState.startIteration(options.Since, names, merger)
+			nextEntry := merger.next
+			unsentEntries := merger.pending
+			if options.Unordered {
+				// An unordered feed also starts a goroutine to forward each feed's entries
+				iterationGoroutines += len(feeds)
+			}
+			db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Add(int64(iterationGoroutines))
+			db.DbStats.ChangesFeed().FeedGoroutinesMax.SetIfMax(int64(1 + iterationGoroutines))
+			if options.Unordered {
+				source := newUnorderedChangesSource(feeds, options.Terminator)
+				nextEntry = source.next
+				unsentEntries = source.pending
+			}
+			if options.LatestOnly {
+				latestEntries := coalesceLatestEntries(merger)
+				nextEntry = changeEntrySliceSource(latestEntries)
+				entriesRead := 0
+				nextLatestEntry := nextEntry
+				nextEntry = func() *ChangeEntry {
+					entry := nextLatestEntry()
+					if entry != nil {
+						entriesRead++
+					}
+					return entry
+				}
+				unsentEntries = func() int {
+					return len(latestEntries) - entriesRead
+				}
+			}
 
 			// This loop reads the available entries from all the feeds in parallel, merges them,
 			// and writes them to the output channel:
@@ -594,60 +2336,31 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			// postStableSeqsFound tracks whether we hit any sequences later than the stable sequence.  In this scenario the user
 			// may not get another wait notification, so we bypass wait loop processing.
 			postStableSeqsFound := false
-			for {
-				// Read more entries to fill up the current[] array:
-				for i, cur := range current {
-					if cur == nil && feeds[i] != nil {
-						var ok bool
-						current[i], ok = <-feeds[i]
-						if !ok {
-							feeds[i] = nil
-						} else {
-							// On feed error, send the error and exit changes processing
-							if current[i].Err == base.ErrChannelFeed {
-								base.WarnfCtx(db.Ctx, "MultiChangesFeed got error reading changes feed: %v", current[i].Err)
-								output <- current[i]
-								return
-							}
-						}
-					}
-				}
-
-				// Find the current entry with the minimum sequence:
-				minSeq := MaxSequenceID
-				var minEntry *ChangeEntry
-				for _, cur := range current {
-					if cur != nil && cur.Seq.Before(minSeq) {
-						minSeq = cur.Seq
-						minEntry = cur
-					}
-				}
 
+			// With InlineUserChanges, the user doc entry is held back and flagged on the next entry sent instead
+			var userChangeEntry *ChangeEntry
+			for {
+				minEntry := nextEntry()
+				userMarker := false
 				if minEntry == nil {
-					break // Exit the loop when there are no more entries
+					if userChangeEntry == nil {
+						break // Exit the loop when there are no more entries
+					}
+					// No other entry followed the user doc in this batch, send a marker instead
+					minEntry = &ChangeEntry{Seq: userChangeEntry.Seq, Changes: []ChangeRev{}}
+					userMarker = true
 				}
 
-				// Clear the current entries for the sequence just sent:
-				if minEntry.Removed != nil {
-					minEntry.allRemoved = true
-				}
-				for i, cur := range current {
-					if cur != nil && cur.Seq == minSeq {
-						current[i] = nil
-						// Track whether this is a removal from all user's channels
-						if cur.Removed == nil && minEntry.allRemoved == true {
-							minEntry.allRemoved = false
-						}
-						// Also concatenate the matching entries' Removed arrays:
-						if cur != minEntry && cur.Removed != nil {
-							if minEntry.Removed == nil {
-								minEntry.Removed = cur.Removed
-							} else {
-								minEntry.Removed = minEntry.Removed.Union(cur.Removed)
-							}
-						}
+				// On feed error, send the error and exit changes processing
+				if minEntry.Err == base.ErrChannelFeed {
+					base.WarnfCtx(db.Ctx, "MultiChangesFeed got error reading changes feed: %v", minEntry.Err)
+					select {
+					case <-options.Terminator:
+					case output <- minEntry:
 					}
+					return
 				}
+				minSeq := minEntry.Seq
 
 				if options.ActiveOnly || minEntry.Seq.TriggeredBy > 0 {
 					if minEntry.Deleted || minEntry.allRemoved {
@@ -669,36 +2382,251 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 					options.Since = minSeq
 				}
 
+				// Entries for other docs, or not sampled, are skipped after Since is updated, so they aren't re-read by the next
+				// iteration, and sent entries are still resumable checkpoints.  Skipped entries don't count towards Limit, and
+				// user doc and marker entries aren't filtered.
+				if docIDFilter != nil && minEntry.ID != "" && !minEntry.principalDoc && !docIDFilter.Contains(minEntry.ID) {
+					continue
+				}
+				if options.SampleRate > 0 && minEntry.ID != "" && !minEntry.principalDoc && rand.Float64() >= options.SampleRate {
+					continue
+				}
+				// The doc body is needed to evaluate the predicate, so is added ahead of the other entry processing
+				docAdded := false
+				if options.FieldPredicate != nil && minEntry.ID != "" && !minEntry.principalDoc {
+					db.addDocToChangeEntry(minEntry, options)
+					docAdded = true
+					if !options.FieldPredicate.matchesEntry(minEntry) {
+						continue
+					}
+				}
+
+				if options.InlineUserChanges {
+					if minEntry.principalDoc {
+						userChangeEntry = minEntry
+						continue
+					}
+					if userChangeEntry != nil {
+						minEntry.UserAccessChanged = true
+						userChangeEntry = nil
+					}
+				}
+
 				// Add the doc body or the conflicting rev IDs, if those options are set:
-				if options.IncludeDocs || options.Conflicts {
+				if (options.IncludeDocs || options.Conflicts) && !docAdded {
 					db.addDocToChangeEntry(minEntry, options)
 				}
+				// A rising number of conflicted docs is an early sign of misbehaving clients or sync function issues
+				if options.Conflicts && len(minEntry.Changes) > 1 {
+					db.DbStats.ChangesFeed().ConflictedEntriesCount.Add(1)
+				}
+				if options.DeltaHints {
+					db.addDeltaHintToChangeEntry(minEntry)
+				}
+				// Docs removed from many channels at once produce large entries - the largest identifies such docs
+				if len(minEntry.Removed) > 0 {
+					db.DbStats.ChangesFeed().RemovedChannelsMax.SetIfMax(int64(len(minEntry.Removed)))
+					if maxRemoved := db.Options.ChangesFeedOptions.MaxRemovedChannels; maxRemoved > 0 && len(minEntry.Removed) > maxRemoved {
+						minEntry.truncateRemoved(maxRemoved)
+					}
+				}
 
 				// Update the low sequence on the entry we're going to send
 				// NOTE: if 0, the low seq part of compound sequence gets removed
 				minEntry.Seq.LowSeq = lowSequence
 				lastSentLowSeq = lowSequence
+				if minEntry.priorityLowSeq > 0 && (lowSequence == 0 || minEntry.priorityLowSeq < lowSequence) {
+					minEntry.Seq.LowSeq = minEntry.priorityLowSeq
+				}
 
 				// Send the entry, and repeat the loop:
-				base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed sending %+v %s", base.UD(minEntry), base.UD(to))
+				if base.JSONLogging && base.LogDebugEnabled(base.KeyChanges) {
+					db.logChangesEvent(base.LevelDebug, "entry_sent", map[string]interface{}{"id": base.UD(minEntry.ID), "seq": minEntry.Seq.String()},
+						"MultiChangesFeed sending %+v %s", base.UD(minEntry), base.UD(to))
+				} else {
+					base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed sending %+v %s", base.UD(minEntry), base.UD(to))
+				}
 
-				select {
-				case <-options.Terminator:
-					return
-				case output <- minEntry:
+				var sendTimer *time.Timer
+				var sendTimeout <-chan time.Time
+				if options.SendTimeout > 0 {
+					sendTimer = time.NewTimer(options.SendTimeout)
+					sendTimeout = sendTimer.C
+				}
+				if !draining {
+					sendStart := time.Now()
+					for sending := true; sending; {
+						// A pending pause takes precedence over sending the entry
+						pause := false
+						select {
+						case <-options.PauseSignal:
+							pause = true
+						default:
+							select {
+							case <-options.Terminator:
+								if !options.DrainOnTerminate {
+									return
+								}
+								base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed draining merged entries before terminating %s", base.UD(to))
+								draining = true
+								sending = false
+							case <-sendTimeout:
+								base.WarnfCtx(db.Ctx, "MultiChangesFeed consumer didn't accept entry within %v - terminating changes feed %s", options.SendTimeout, base.UD(to))
+								return
+							case <-options.PauseSignal:
+								pause = true
+							case output <- minEntry:
+								sending = false
+							}
+						}
+						if pause {
+							// SendTimeout doesn't apply while paused, and restarts on resume
+							if sendTimer != nil && !sendTimer.Stop() {
+								<-sendTimer.C
+							}
+							pausedTime, resumed := db.waitForChangesResume(options, to)
+							if !resumed {
+								return
+							}
+							sendStart = sendStart.Add(pausedTime)
+							iterationStart = iterationStart.Add(pausedTime)
+							if sendTimer != nil {
+								sendTimer.Reset(options.SendTimeout)
+							}
+						}
+					}
+					sendBlocked := time.Since(sendStart)
+					sendBlockedTime += sendBlocked
+					db.DbStats.ChangesFeed().SendBlockedTime.Add(sendBlocked.Nanoseconds())
+				}
+				if sendTimer != nil {
+					sendTimer.Stop()
+				}
+				if draining {
+					// Terminating - only send while there's space in the output buffer
+					select {
+					case output <- minEntry:
+					default:
+						return
+					}
 				}
 				sentSomething = true
+				entriesSent++
+				if minEntry.Seq.TriggeredBy > 0 {
+					backfillEntriesSent++
+					if backfillWarningThreshold >= 0 && backfillEntriesSent == backfillWarningThreshold+1 {
+						base.WarnfCtx(db.Ctx, "MultiChangesFeed has sent more than %d backfilled entries (backfill triggered by %d) - consider granting newly required docs through smaller channels %s", backfillWarningThreshold, minEntry.Seq.TriggeredBy, base.UD(to))
+					}
+				}
+				if idleTimer != nil {
+					signalChangesActivity(activity)
+				}
+				if !draining && !sendFeedStats() {
+					return
+				}
 
-				// Stop when we hit the limit (if any):
-				if options.Limit > 0 {
+				if options.AuditSink != nil {
+					auditUser := ""
+					if db.user != nil {
+						auditUser = db.user.Name()
+					}
+					options.AuditSink.Record(auditUser, minEntry.ID, minEntry.Seq, minEntry.Channels, time.Now())
+				}
+
+				// Time to first entry is recorded once per feed, to distinguish initial (backfill) latency from
+				// subsequent streaming.
+				if !firstEntrySent {
+					firstEntrySent = true
+					db.DbStats.ChangesFeed().FirstEntryCount.Add(1)
+					db.DbStats.ChangesFeed().FirstEntryTime.Add(time.Since(feedStartTime).Nanoseconds())
+				}
+
+				// Stop when we hit the limit (if any).  Backfill and user markers don't count towards the limit.
+				if options.Limit > 0 && minEntry.BackfillComplete == nil && !userMarker {
 					options.Limit--
 					if options.Limit == 0 {
+						// Track feeds truncated by the limit, to identify clients paginating with too-small limits.
+						// The number of remaining entries is only an estimate, based on what's already been read
+						// into the channel feeds.
+						if remaining := unsentEntries(); remaining > 0 {
+							db.DbStats.ChangesFeed().LimitTruncatedFeeds.Add(1)
+							db.DbStats.ChangesFeed().LimitTruncatedEntries.Add(int64(remaining))
+						}
 						break outer
 					}
 				}
 			}
 
+			// The iteration's feeds have all been read, so their goroutines are done
+			db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Add(-int64(iterationGoroutines))
+			iterationGoroutines = 0
+
+			// Backfill is complete once the last entry sent isn't a backfilled entry
+			if options.Since.TriggeredBy == 0 {
+				setInBackfill(false)
+			}
+
+			// Let the consumer know that channels were omitted from this iteration
+			channelsFailed = len(merger.failedChannels) > 0
+			if channelsFailed {
+				base.WarnfCtx(db.Ctx, "MultiChangesFeed omitted channels %s after errors reading changes feed %s", base.UD(merger.failedChannels), base.UD(to))
+				if options.FailedChannelWarnings && !draining {
+					warning := ChangeEntry{
+						Seq:            options.Since,
+						Changes:        []ChangeRev{},
+						FailedChannels: merger.failedChannels,
+					}
+					select {
+					case <-options.Terminator:
+						return
+					case output <- &warning:
+					}
+					sentSomething = true
+				}
+			}
+
+			// Unordered entries aren't resumable checkpoints, so mark the end of the iteration with one that is
+			if options.Unordered && sentSomething && !draining {
+				checkpoint := ChangeEntry{Seq: options.Since, Changes: []ChangeRev{}}
+				checkpoint.Seq.LowSeq = lowSequence
+				select {
+				case <-options.Terminator:
+					return
+				case output <- &checkpoint:
+				}
+			}
+
+			// Track whether waking up for this iteration resulted in anything being sent to the client.  A low ratio
+			// of productive wakeups indicates feeds are frequently notified about changes that aren't visible to them.
+			if wokenUp {
+				if sentSomething {
+					db.DbStats.ChangesFeed().NumProductiveWakeups.Add(1)
+					unproductiveWakeups = 0
+				} else {
+					unproductiveWakeups++
+					if unproductiveWakeups == wakeupsWarningThreshold {
+						base.WarnfCtx(db.Ctx, "MultiChangesFeed woken %d consecutive times without sending anything - the feed's channels may be receiving changes it can't see (e.g. shared with other users' docs) %s", unproductiveWakeups, base.UD(to))
+						unproductiveWakeups = 0
+					}
+				}
+				wokenUp = false
+			}
+
+			// Entries already merged have been flushed, don't start another iteration
+			if draining {
+				return
+			}
+
 			if !options.Continuous && (sentSomething || changeWaiter == nil) {
+				if options.EmitCaughtUp {
+					caughtUp := ChangeEntry{Seq: options.Since, Changes: []ChangeRev{}, CaughtUp: true}
+					caughtUp.Seq.LowSeq = lowSequence
+					select {
+					case <-options.Terminator:
+						return
+					case output <- &caughtUp:
+					}
+				}
 				break
 			}
 
@@ -711,8 +2639,16 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 
 			// If nothing found, and in wait mode: wait for the db to change, then run again.
 			// First notify the reader that we're waiting by sending a nil.
-			base.DebugfCtx(db.Ctx, base.KeyChanges, "MultiChangesFeed waiting... %s", base.UD(to))
-			output <- nil
+			db.logChangesEvent(base.LevelDebug, "wait", map[string]interface{}{"seq": options.Since.String()}, "MultiChangesFeed waiting... %s", base.UD(to))
+			activeTime += time.Since(iterationStart)
+			select {
+			case <-options.Terminator:
+				// e.g. options.IdleTimeout elapsed while the consumer wasn't reading
+				return
+			case output <- nil:
+			}
+			db.changeListeners.update(listenerID, channelsSince.AsSet(), options.Since)
+			db.changeListeners.updateSendBlocked(listenerID, sendBlockedTime, activeTime)
 
 			// If this is an initial replication using CBL 2.x (active only), flip activeOnly now the client has caught up.
 			if options.clientType == clientTypeCBL2 && options.ActiveOnly {
@@ -746,8 +2682,28 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 					case <-options.Terminator:
 						return
 					default:
-						break waitForChanges
+						db.DbStats.ChangesFeed().NumWakeups.Add(1)
+					}
+					// Re-running the iteration is expensive for feeds with many channels - skip it when nothing the feed
+					// could send has arrived since it last ran (e.g. when notified of changes the previous iteration had
+					// already sent), and resume waiting.  Iterations that omitted failed channels are always
+					// re-run, to retry those channels.
+					if options.Continuous && !channelsFailed && !db.wakeupHasChanges(currentCachedSequence, userCounter, changeWaiter, lateSequenceFeeds) {
+						db.DbStats.ChangesFeed().NumSkippedWakeups.Add(1)
+						continue
 					}
+					// Only wakeups that re-run the iteration count towards the feed's wakeups, and whether they were productive
+					wokenUp = true
+					wakeups++
+					// Spread out the re-fetch of continuous feeds woken by the same change
+					if jitter := changesWakeupJitter(db.Options.ChangesFeedOptions.WakeupJitterMax); options.Continuous && jitter > 0 {
+						select {
+						case <-options.Terminator:
+							return
+						case <-time.After(jitter):
+						}
+					}
+					break waitForChanges
 				} else if waitResponse == WaiterCheckTerminated {
 					// Check whether I was terminated while waiting for a change.  If not, resume wait.
 					select {
@@ -761,19 +2717,28 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 			currentCachedSequence = db.changeCache.getChannelCache().GetHighCacheSequence()
 
 			// Check whether user channel access has changed while waiting:
-			var err error
-			userChanged, userCounter, changedChannels, err = db.checkForUserUpdates(userCounter, changeWaiter, options.Continuous)
-			if err != nil {
-				change := makeErrorEntry("User not found during reload - terminating changes feed")
-				base.DebugfCtx(db.Ctx, base.KeyChanges, "User not found during reload - terminating changes feed with entry %+v", base.UD(change))
-				output <- &change
-				return
+			if !isGuest {
+				var err error
+				userChanged, userCounter, changedChannels, err = db.checkForUserUpdates(userCounter, changeWaiter, options.Continuous)
+				if err != nil {
+					change := makeErrorEntry("User not found during reload - terminating changes feed")
+					base.DebugfCtx(db.Ctx, base.KeyChanges, "User not found during reload - terminating changes feed with entry %+v", base.UD(change))
+					select {
+					case <-options.Terminator:
+					case output <- &change:
+					}
+					return
+				}
 			}
 			if userChanged && db.user != nil {
-				newChannelsSince := db.user.FilterToAvailableChannels(chans)
+				newChannelsSince := db.filterToAvailableChannels(chans, options)
 				changedChannels = newChannelsSince.CompareKeys(channelsSince)
 				if len(changedChannels) > 0 {
 					db.activeChannels.UpdateChanged(changedChannels)
+					if options.OnAccessChange != nil {
+						added, removed := splitChangedKeys(changedChannels)
+						options.OnAccessChange(added, removed)
+					}
 				}
 				channelsSince = newChannelsSince
 			}
@@ -791,7 +2756,69 @@ func (db *Database) SimpleMultiChangesFeed(chans base.Set, options ChangesOption
 		}
 	}()
 
-	return output, nil
+	return output, listenerID, nil
+}
+
+// Returns whether anything has arrived since a continuous feed's last iteration that the feed might need to process on
+// wakeup - sequences cached after cachedSequence, late-arriving sequences in the feed's channels, or a change to the
+// feed's user or roles.
+func (db *Database) wakeupHasChanges(cachedSequence, userCounter uint64, changeWaiter *ChangeWaiter, lateSequenceFeeds map[string]*lateSequenceFeed) bool {
+	if db.changeCache.getChannelCache().GetHighCacheSequence() != cachedSequence {
+		return true
+	}
+	if changeWaiter.CurrentUserCount() > userCounter {
+		return true
+	}
+	for channel, lateFeed := range lateSequenceFeeds {
+		singleChannelCache := db.changeCache.getChannelCache().getSingleChannelCache(channel)
+		if !singleChannelCache.SupportsLateFeed() || singleChannelCache.LateSequenceUUID() != lateFeed.lateSequenceUUID {
+			return true
+		}
+		if singleChannelCache.LastLateSequence() != lateFeed.lastSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserves a slot for a new changes feed when ChangesFeedOptions.MaxConcurrentFeeds is set.  When all slots are in use,
+// waits up to MaxConcurrentFeedsWait for an active feed to finish, unless terminator or the database's terminator is
+// closed first.  Returns false if no slot could be reserved.
+func (dbc *DatabaseContext) acquireChangesFeedSlot(terminator chan bool) bool {
+	if dbc.changesFeedSlots == nil {
+		return true
+	}
+
+	select {
+	case dbc.changesFeedSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	wait := dbc.Options.ChangesFeedOptions.MaxConcurrentFeedsWait
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case dbc.changesFeedSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-terminator:
+		return false
+	case <-dbc.terminator:
+		return false
+	}
+}
+
+// Releases a slot reserved by acquireChangesFeedSlot.
+func (dbc *DatabaseContext) releaseChangesFeedSlot() {
+	if dbc.changesFeedSlots == nil {
+		return
+	}
+	<-dbc.changesFeedSlots
 }
 
 // Synchronous convenience function that returns all changes as a simple array, FOR TEST USE ONLY
@@ -869,7 +2896,7 @@ func (db *Database) newLateSequenceFeed(singleChannelCache SingleChannelCache) *
 
 // Feed to process late sequences for the channel.  Updates lastSequence as it works the feed.  Error indicates
 // previous position in late sequence feed isn't available, and caller should reset to low sequence.
-func (db *Database) getLateFeed(feedHandler *lateSequenceFeed, singleChannelCache SingleChannelCache) (<-chan *ChangeEntry, error) {
+func (db *Database) getLateFeed(feedHandler *lateSequenceFeed, singleChannelCache SingleChannelCache, options ChangesOptions) (<-chan *ChangeEntry, error) {
 
 	if !singleChannelCache.SupportsLateFeed() {
 		return nil, errors.New("Cache doesn't support late feeds")
@@ -908,8 +2935,15 @@ func (db *Database) getLateFeed(feedHandler *lateSequenceFeed, singleChannelCach
 			seqID := SequenceID{
 				Seq: logEntry.Sequence,
 			}
-			change := makeChangeEntry(logEntry, seqID, singleChannelCache.ChannelName())
-			feed <- &change
+			change := makeChangeEntry(logEntry, seqID, singleChannelCache.ChannelName(), options.IncludeMetadata, options.IncludeRemovalReasons)
+			if options.IncludeChannels {
+				change.Channels = []string{singleChannelCache.ChannelName()}
+			}
+			select {
+			case <-options.Terminator:
+				return
+			case feed <- &change:
+			}
 		}
 	}()
 
@@ -1011,6 +3045,9 @@ func createChangesEntry(docid string, db *Database, options ChangesOptions) *Cha
 					if removal.Deleted {
 						row.Deleted = true
 					}
+					if options.IncludeRemovalReasons {
+						row.addRemovalReasons(map[string]RemovalReason{channel: removalReason(removal.Deleted)})
+					}
 				}
 			}
 		}
@@ -1024,6 +3061,7 @@ func createChangesEntry(docid string, db *Database, options ChangesOptions) *Cha
 	if options.IncludeDocs || options.Conflicts {
 		db.AddDocInstanceToChangeEntry(row, populatedDoc, options)
 	}
+	db.limitChangeEntryDoc(row, options)
 
 	return row
 }
@@ -1095,6 +3133,7 @@ func GenerateChanges(cancelCtx context.Context, database *Database, inChannels b
 
 	var lastSeq SequenceID
 	var feed <-chan *ChangeEntry
+	var listenerID string // Used to reset the feed's IdleTimeout when a heartbeat is acknowledged
 	var timeout <-chan time.Time
 
 	// feedStarted identifies whether at least one MultiChangesFeed has been started.  Used to identify when a one-shot changes is done.
@@ -1121,7 +3160,7 @@ loop:
 			if len(docIDFilter) > 0 {
 				feed, feedErr = database.DocIDChangesFeed(inChannels, docIDFilter, options)
 			} else {
-				feed, feedErr = database.MultiChangesFeed(inChannels, options)
+				feed, listenerID, feedErr = database.MultiChangesFeedWithID(inChannels, options)
 			}
 			if feedErr != nil || feed == nil {
 				return feedErr, forceClose
@@ -1175,13 +3214,21 @@ loop:
 					sendErr = send(nil)
 				}
 
-				lastSeq = entries[len(entries)-1].Seq
+				// Markers aren't counted towards the limit by the feed, so aren't counted here either, and aren't used to
+				// resume the feed
+				docEntries := 0
+				for _, entry := range entries {
+					if !entry.isMarker() {
+						lastSeq = entry.Seq
+						docEntries++
+					}
+				}
 				if options.Limit > 0 {
-					if len(entries) >= options.Limit {
+					if docEntries >= options.Limit {
 						forceClose = true
 						break loop
 					}
-					options.Limit -= len(entries)
+					options.Limit -= docEntries
 				}
 			}
 			// Reset the timeout after sending an entry:
@@ -1191,6 +3238,9 @@ loop:
 			}
 		case <-heartbeat:
 			sendErr = send(nil)
+			if sendErr == nil {
+				database.changeListeners.touch(listenerID)
+			}
 			base.DebugfCtx(database.Ctx, base.KeyChanges, "heartbeat written to _changes feed for request received")
 		case <-timeout:
 			forceClose = true
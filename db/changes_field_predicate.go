@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// FieldPredicateOperator is the comparison made by a FieldPredicate.
+type FieldPredicateOperator string
+
+const (
+	FieldPredicateEquals             FieldPredicateOperator = "eq"     // The property equals Value
+	FieldPredicateExists             FieldPredicateOperator = "exists" // The property is present (Value is ignored)
+	FieldPredicateLessThan           FieldPredicateOperator = "lt"     // The property is a number less than Value
+	FieldPredicateLessThanOrEqual    FieldPredicateOperator = "lte"    // The property is a number less than or equal to Value
+	FieldPredicateGreaterThan        FieldPredicateOperator = "gt"     // The property is a number greater than Value
+	FieldPredicateGreaterThanOrEqual FieldPredicateOperator = "gte"    // The property is a number greater than or equal to Value
+)
+
+// FieldPredicate is a declarative filter on doc bodies, for simple filtering of a changes feed without a sync
+// function (see ChangesOptions.FieldPredicate).
+type FieldPredicate struct {
+	Path     string                 `json:"path"`            // Dot-separated path of the property tested, e.g. "address.city"
+	Operator FieldPredicateOperator `json:"op"`              // One of the FieldPredicate operator constants
+	Value    interface{}            `json:"value,omitempty"` // Compared with the property - must be a number for numeric comparisons
+}
+
+// Returns an error if the predicate can't be evaluated for a feed with the given options.
+func (p *FieldPredicate) validate(options ChangesOptions) error {
+	if !options.IncludeDocs {
+		return base.HTTPErrorf(http.StatusBadRequest, "FieldPredicate requires IncludeDocs")
+	}
+	if p.Path == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "FieldPredicate path must be specified")
+	}
+	if len(options.DocFields) > 0 {
+		topLevel := strings.SplitN(p.Path, ".", 2)[0]
+		if !base.StringSliceContains(options.DocFields, topLevel) {
+			return base.HTTPErrorf(http.StatusBadRequest, "FieldPredicate path %q isn't included in DocFields", p.Path)
+		}
+	}
+	switch p.Operator {
+	case FieldPredicateEquals, FieldPredicateExists:
+	case FieldPredicateLessThan, FieldPredicateLessThanOrEqual, FieldPredicateGreaterThan, FieldPredicateGreaterThanOrEqual:
+		if _, ok := predicateNumber(p.Value); !ok {
+			return base.HTTPErrorf(http.StatusBadRequest, "FieldPredicate operator %q requires a numeric value", p.Operator)
+		}
+	default:
+		return base.HTTPErrorf(http.StatusBadRequest, "Unknown FieldPredicate operator %q", p.Operator)
+	}
+	return nil
+}
+
+// Returns whether the entry's doc body matches the predicate.  Entries without a body (e.g. deletions, removals and
+// docs omitted by MaxDocBytes) always match, as they can't be evaluated, and a client that's received the doc may
+// need them.
+func (p *FieldPredicate) matchesEntry(entry *ChangeEntry) bool {
+	if entry.Doc == nil {
+		return true
+	}
+	var body map[string]interface{}
+	if err := base.JSONUnmarshal(entry.Doc, &body); err != nil {
+		return true
+	}
+	return p.matches(body)
+}
+
+// Returns whether the body's property at the predicate's path satisfies the predicate.
+func (p *FieldPredicate) matches(body map[string]interface{}) bool {
+	var value interface{} = body
+	for _, name := range strings.Split(p.Path, ".") {
+		properties, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = properties[name]; !ok {
+			return false
+		}
+	}
+
+	switch p.Operator {
+	case FieldPredicateExists:
+		return true
+	case FieldPredicateEquals:
+		if number, ok := predicateNumber(value); ok {
+			expected, ok := predicateNumber(p.Value)
+			return ok && number == expected
+		}
+		return reflect.DeepEqual(value, p.Value)
+	}
+
+	number, ok := predicateNumber(value)
+	if !ok {
+		return false
+	}
+	expected, _ := predicateNumber(p.Value)
+	switch p.Operator {
+	case FieldPredicateLessThan:
+		return number < expected
+	case FieldPredicateLessThanOrEqual:
+		return number <= expected
+	case FieldPredicateGreaterThan:
+		return number > expected
+	case FieldPredicateGreaterThanOrEqual:
+		return number >= expected
+	}
+	return false
+}
+
+// Returns the value as a float64, if it's a number - as unmarshalled from a doc body, or set in a predicate.
+func predicateNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
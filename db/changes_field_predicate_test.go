@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldPredicateMatches(t *testing.T) {
+
+	body := map[string]interface{}{
+		"type":    "order",
+		"total":   float64(42),
+		"address": map[string]interface{}{"city": "Paris"},
+	}
+
+	testCases := []struct {
+		name      string
+		predicate FieldPredicate
+		matches   bool
+	}{
+		{"equals string", FieldPredicate{Path: "type", Operator: FieldPredicateEquals, Value: "order"}, true},
+		{"equals other string", FieldPredicate{Path: "type", Operator: FieldPredicateEquals, Value: "invoice"}, false},
+		{"equals int", FieldPredicate{Path: "total", Operator: FieldPredicateEquals, Value: 42}, true},
+		{"equals nested", FieldPredicate{Path: "address.city", Operator: FieldPredicateEquals, Value: "Paris"}, true},
+		{"exists", FieldPredicate{Path: "address", Operator: FieldPredicateExists}, true},
+		{"exists missing", FieldPredicate{Path: "customer", Operator: FieldPredicateExists}, false},
+		{"exists under non-object", FieldPredicate{Path: "type.name", Operator: FieldPredicateExists}, false},
+		{"less than", FieldPredicate{Path: "total", Operator: FieldPredicateLessThan, Value: 50}, true},
+		{"less than or equal", FieldPredicate{Path: "total", Operator: FieldPredicateLessThanOrEqual, Value: 42}, true},
+		{"greater than", FieldPredicate{Path: "total", Operator: FieldPredicateGreaterThan, Value: 42}, false},
+		{"greater than or equal", FieldPredicate{Path: "total", Operator: FieldPredicateGreaterThanOrEqual, Value: 42.0}, true},
+		{"numeric comparison of string", FieldPredicate{Path: "type", Operator: FieldPredicateGreaterThan, Value: 0}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.matches, tc.predicate.matches(body))
+		})
+	}
+}
+
+func TestChangesFieldPredicate(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for _, doc := range []struct {
+		id  string
+		typ string
+	}{{"order1", "order"}, {"invoice1", "invoice"}, {"order2", "order"}} {
+		_, _, err := db.Put(doc.id, Body{"channels": []string{"ABC"}, "type": doc.typ})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// The non-matching invoice doesn't count towards the limit
+	options := getZeroSequence()
+	options.IncludeDocs = true
+	options.Limit = 2
+	options.FieldPredicate = &FieldPredicate{Path: "type", Operator: FieldPredicateEquals, Value: "order"}
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "order1", changes[0].ID)
+	assert.Equal(t, "order2", changes[1].ID)
+
+	// Predicates require the doc body, and a known operator
+	options.IncludeDocs = false
+	_, err = db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+	options.IncludeDocs = true
+	options.FieldPredicate = &FieldPredicate{Path: "type", Operator: "like", Value: "ord%"}
+	_, err = db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+}
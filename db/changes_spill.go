@@ -0,0 +1,196 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Estimated size of a ChangeEntry excluding its ID and doc body, used to bound memory held by changeEntrySpillBuffer.
+const changeEntryOverheadBytes = 200
+
+// Returns the estimated memory held by an entry.
+func estimatedChangeEntrySize(entry *ChangeEntry) int {
+	return changeEntryOverheadBytes + len(entry.ID) + len(entry.Doc)
+}
+
+// changeEntrySpillBuffer is an append-only buffer of change entries, for feeds that need to buffer more entries than
+// fit comfortably in memory (see ChangesOptions.MaxBufferedBytes).  Entries are held in memory until spill is called,
+// or their estimated size exceeds maxMemoryBytes when set, then written to a temp file as a segment.  Entries can be
+// read back in order, or in reverse.  Spilled entries are round-tripped through JSON, so only their exported fields are
+// retained - entries are expected to have been fully prepared by the feed, and error entries can't be buffered.
+type changeEntrySpillBuffer struct {
+	maxMemoryBytes int            // Spill once more than this is held in memory - zero means only spill when spill is called
+	memory         []*ChangeEntry // Entries appended since the last spill
+	memoryBytes    int            // Estimated size of memory
+	file           *os.File       // Temp file holding spilled segments, created by the first spill
+	fileSize       int64
+	segments       []changeEntrySpillSegment
+	spilledCount   int // Entries in segments
+}
+
+// A run of entries written to the spill file.
+type changeEntrySpillSegment struct {
+	offset int64
+	length int64
+	count  int
+}
+
+func newChangeEntrySpillBuffer(maxMemoryBytes int) *changeEntrySpillBuffer {
+	return &changeEntrySpillBuffer{maxMemoryBytes: maxMemoryBytes}
+}
+
+func (b *changeEntrySpillBuffer) append(entry *ChangeEntry) error {
+	b.memory = append(b.memory, entry)
+	b.memoryBytes += estimatedChangeEntrySize(entry)
+	if b.maxMemoryBytes > 0 && b.memoryBytes > b.maxMemoryBytes {
+		return b.spill()
+	}
+	return nil
+}
+
+// Writes the entries held in memory to the spill file.
+func (b *changeEntrySpillBuffer) spill() error {
+	if len(b.memory) == 0 {
+		return nil
+	}
+	if b.file == nil {
+		file, err := ioutil.TempFile("", "sg-changes-*.spill")
+		if err != nil {
+			return err
+		}
+		b.file = file
+	}
+
+	var buf bytes.Buffer
+	encoder := base.JSONEncoder(&buf)
+	for _, entry := range b.memory {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if _, err := b.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	b.segments = append(b.segments, changeEntrySpillSegment{offset: b.fileSize, length: int64(buf.Len()), count: len(b.memory)})
+	b.fileSize += int64(buf.Len())
+	b.spilledCount += len(b.memory)
+
+	// Release the spilled entries
+	b.memory = nil
+	b.memoryBytes = 0
+	return nil
+}
+
+// Drops spilled segments from the start of the buffer, for as long as at least keep entries remain.  The spill file
+// is compacted once the dropped segments make up most of it, so that its size stays proportional to the entries kept.
+func (b *changeEntrySpillBuffer) dropLeading(keep int) error {
+	dropped := false
+	for len(b.segments) > 0 && b.spilledCount-b.segments[0].count+len(b.memory) >= keep {
+		b.spilledCount -= b.segments[0].count
+		b.segments = b.segments[1:]
+		dropped = true
+	}
+	if !dropped {
+		return nil
+	}
+
+	start := b.fileSize
+	if len(b.segments) > 0 {
+		start = b.segments[0].offset
+	}
+	if start < b.fileSize-start {
+		return nil
+	}
+
+	// Move the remaining segments to the start of the file.  Data is only ever copied towards the start, so is read
+	// before it's overwritten.
+	chunk := make([]byte, 64*1024)
+	for copied := int64(0); copied < b.fileSize-start; {
+		n, err := b.file.ReadAt(chunk, start+copied)
+		if n == 0 && err != nil {
+			return err
+		}
+		if _, err := b.file.WriteAt(chunk[:n], copied); err != nil {
+			return err
+		}
+		copied += int64(n)
+	}
+	for i := range b.segments {
+		b.segments[i].offset -= start
+	}
+	b.fileSize -= start
+	if err := b.file.Truncate(b.fileSize); err != nil {
+		return err
+	}
+	// Subsequent spills are appended at the new end of the file
+	_, err := b.file.Seek(b.fileSize, io.SeekStart)
+	return err
+}
+
+func (b *changeEntrySpillBuffer) readSegment(segment changeEntrySpillSegment) ([]*ChangeEntry, error) {
+	decoder := base.JSONDecoder(io.NewSectionReader(b.file, segment.offset, segment.length))
+	entries := make([]*ChangeEntry, 0, segment.count)
+	for i := 0; i < segment.count; i++ {
+		entry := &ChangeEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Calls fn with each buffered entry, in the order appended (or in reverse), until fn returns false.  Only one spilled
+// segment is read into memory at a time.
+func (b *changeEntrySpillBuffer) forEach(reverse bool, fn func(entry *ChangeEntry) bool) error {
+	each := func(entries []*ChangeEntry) bool {
+		for i := range entries {
+			if reverse {
+				i = len(entries) - 1 - i
+			}
+			if !fn(entries[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if reverse && !each(b.memory) {
+		return nil
+	}
+	for i := range b.segments {
+		if reverse {
+			i = len(b.segments) - 1 - i
+		}
+		entries, err := b.readSegment(b.segments[i])
+		if err != nil {
+			return err
+		}
+		if !each(entries) {
+			return nil
+		}
+	}
+	if !reverse {
+		each(b.memory)
+	}
+	return nil
+}
+
+// Releases the buffered entries, and removes the spill file.
+func (b *changeEntrySpillBuffer) close() {
+	b.memory = nil
+	b.memoryBytes = 0
+	b.segments = nil
+	b.spilledCount = 0
+	if b.file != nil {
+		_ = b.file.Close()
+		if err := os.Remove(b.file.Name()); err != nil {
+			base.Warnf("Unable to remove changes spill file %q: %v", b.file.Name(), err)
+		}
+		b.file = nil
+	}
+}
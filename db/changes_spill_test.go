@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeEntrySpillBuffer(t *testing.T) {
+
+	// Every second entry exceeds the limit, so entries are spilled in segments of two, leaving the fifth in memory
+	buffer := newChangeEntrySpillBuffer(2*changeEntryOverheadBytes + 20)
+	for i := 1; i <= 5; i++ {
+		entry := &ChangeEntry{
+			Seq:     SequenceID{LowSeq: 1, Seq: uint64(i)},
+			ID:      fmt.Sprintf("doc%d", i),
+			Removed: base.SetOf("ABC"),
+			Doc:     []byte(fmt.Sprintf(`{"value":%d}`, i)),
+			Changes: []ChangeRev{{"rev": "1-a"}},
+		}
+		require.NoError(t, buffer.append(entry))
+	}
+	require.NotNil(t, buffer.file)
+	assert.Len(t, buffer.segments, 2)
+	assert.Len(t, buffer.memory, 1)
+
+	var entries []*ChangeEntry
+	require.NoError(t, buffer.forEach(false, func(entry *ChangeEntry) bool {
+		entries = append(entries, entry)
+		return true
+	}))
+	require.Len(t, entries, 5)
+	for i, entry := range entries {
+		assert.Equal(t, fmt.Sprintf("doc%d", i+1), entry.ID)
+		assert.Equal(t, SequenceID{LowSeq: 1, Seq: uint64(i + 1)}, entry.Seq)
+		assert.Equal(t, base.SetOf("ABC"), entry.Removed)
+		assert.JSONEq(t, fmt.Sprintf(`{"value":%d}`, i+1), string(entry.Doc))
+		assert.Equal(t, []ChangeRev{{"rev": "1-a"}}, entry.Changes)
+	}
+
+	// Reverse reads stop when fn returns false
+	var ids []string
+	require.NoError(t, buffer.forEach(true, func(entry *ChangeEntry) bool {
+		ids = append(ids, entry.ID)
+		return len(ids) < 4
+	}))
+	assert.Equal(t, []string{"doc5", "doc4", "doc3", "doc2"}, ids)
+
+	fileName := buffer.file.Name()
+	buffer.close()
+	_, err := os.Stat(fileName)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChangeEntrySpillBufferDropLeading(t *testing.T) {
+
+	// Segments of two entries, keeping at least the last three
+	buffer := newChangeEntrySpillBuffer(2*changeEntryOverheadBytes + 20)
+	defer buffer.close()
+	for i := 1; i <= 9; i++ {
+		entry := &ChangeEntry{
+			Seq:     SequenceID{Seq: uint64(i)},
+			ID:      fmt.Sprintf("doc%d", i),
+			Doc:     []byte(fmt.Sprintf(`{"value":%d}`, i)),
+			Changes: []ChangeRev{{"rev": "1-a"}},
+		}
+		require.NoError(t, buffer.append(entry))
+		require.NoError(t, buffer.dropLeading(3))
+	}
+
+	var ids []string
+	require.NoError(t, buffer.forEach(false, func(entry *ChangeEntry) bool {
+		ids = append(ids, entry.ID)
+		return true
+	}))
+	assert.Equal(t, []string{"doc7", "doc8", "doc9"}, ids)
+
+	// The dropped segments have been compacted out of the spill file
+	require.Len(t, buffer.segments, 1)
+	assert.Equal(t, int64(0), buffer.segments[0].offset)
+	assert.Equal(t, buffer.segments[0].length, buffer.fileSize)
+	fileInfo, err := buffer.file.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, buffer.fileSize, fileInfo.Size())
+
+	// Entries spilled after compaction are appended to the remaining segments
+	require.NoError(t, buffer.spill())
+	ids = nil
+	require.NoError(t, buffer.forEach(true, func(entry *ChangeEntry) bool {
+		ids = append(ids, entry.ID)
+		return true
+	}))
+	assert.Equal(t, []string{"doc9", "doc8", "doc7"}, ids)
+}
+
+func TestChangesMaxBufferedBytes(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		channel := "ABC"
+		if i%2 == 0 {
+			channel = "PBS"
+		}
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	getIDs := func(options ChangesOptions) []string {
+		changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.ID)
+		}
+		return ids
+	}
+
+	// Spilling every entry doesn't change the entries sent
+	options := getZeroSequence()
+	options.Descending = true
+	options.Limit = 4
+	expected := getIDs(options)
+	assert.Equal(t, []string{"doc5", "doc4", "doc3", "doc2"}, expected)
+	options.MaxBufferedBytes = 1
+	assert.Equal(t, expected, getIDs(options))
+
+	options = getZeroSequence()
+	options.GroupByChannel = true
+	expected = getIDs(options)
+	assert.Equal(t, []string{"doc1", "doc3", "doc5", "doc2", "doc4"}, expected)
+	options.MaxBufferedBytes = 1
+	assert.Equal(t, expected, getIDs(options))
+}
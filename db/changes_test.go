@@ -11,10 +11,17 @@ package db
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/channels"
@@ -349,6 +356,2323 @@ func TestActiveOnlyCacheUpdate(t *testing.T) {
 
 }
 
+func TestChangesIncludeDocsFields(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	revID, _, err := db.Put("doc1", Body{"status": "active", "count": 5, "payload": "large"})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.IncludeDocs = true
+	options.DocFields = []string{"status", "missing"}
+
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	var body map[string]interface{}
+	require.NoError(t, base.JSONUnmarshal(changes[0].Doc, &body))
+	assert.Equal(t, map[string]interface{}{
+		BodyId:   "doc1",
+		BodyRev:  revID,
+		"status": "active",
+	}, body)
+
+	// Empty DocFields returns the full body
+	options.DocFields = nil
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	body = nil
+	require.NoError(t, base.JSONUnmarshal(changes[0].Doc, &body))
+	assert.Equal(t, "large", body["payload"])
+	assert.Equal(t, float64(5), body["count"])
+}
+
+func TestChangesMaxDocBytes(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("small", Body{"payload": "a"})
+	require.NoError(t, err)
+	_, _, err = db.Put("large", Body{"payload": strings.Repeat("a", 1000)})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.IncludeDocs = true
+	options.MaxDocBytes = 500
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, "small", changes[0].ID)
+	assert.NotNil(t, changes[0].Doc)
+	assert.False(t, changes[0].DocTooLarge)
+
+	// The oversized entry is still sent, without its body
+	assert.Equal(t, "large", changes[1].ID)
+	assert.Nil(t, changes[1].Doc)
+	assert.True(t, changes[1].DocTooLarge)
+
+	// Doc ID filtered feeds apply the same limit
+	feed, err := db.DocIDChangesFeed(base.SetOf("*"), []string{"small", "large"}, options)
+	require.NoError(t, err)
+	docIDChanges := make(map[string]*ChangeEntry)
+	for entry := range feed {
+		docIDChanges[entry.ID] = entry
+	}
+	require.Len(t, docIDChanges, 2)
+	assert.NotNil(t, docIDChanges["small"].Doc)
+	assert.False(t, docIDChanges["small"].DocTooLarge)
+	assert.Nil(t, docIDChanges["large"].Doc)
+	assert.True(t, docIDChanges["large"].DocTooLarge)
+}
+
+// Validates that a feed whose consumer stops reading is terminated once SendTimeout elapses
+func TestChangesSendTimeout(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Write more docs than fit in the feed's output buffer
+	numDocs := 60
+	for i := 0; i < numDocs; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"foo": "bar"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	options.SendTimeout = 50 * time.Millisecond
+
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	// Stall the consumer long enough for the send timeout to fire
+	time.Sleep(250 * time.Millisecond)
+
+	received := 0
+	for range feed {
+		received++
+	}
+	assert.True(t, received < numDocs, "Expected feed to terminate before all %d entries were sent, got %d", numDocs, received)
+}
+
+func TestChangesLatestOnly(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// Removal from A is recorded at sequence 2, the most recent change in B at sequence 3
+	rev1, _, err := db.Put("doc1", Body{"channels": []string{"A", "B"}})
+	require.NoError(t, err)
+	rev2, _, err := db.Put("doc1", Body{BodyRev: rev1, "channels": []string{"B"}})
+	require.NoError(t, err)
+	rev3, _, err := db.Put("doc1", Body{BodyRev: rev2, "channels": []string{"B"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	changes, err := db.GetChanges(base.SetOf("A", "B"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	options.LatestOnly = true
+	changes, err = db.GetChanges(base.SetOf("A", "B"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.Equal(t, []ChangeRev{{"rev": rev3}}, changes[0].Changes)
+}
+
+// A channel granted at sequence S isn't backfilled for a client whose since is already at or after S, and a
+// resumed backfill isn't restarted.
+func TestChangesGrantBeforeSince(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// doc1 in PBS (sequence 1), grant PBS (sequence 2), doc2 in PBS (sequence 3)
+	_, _, err := db.Put("doc1", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Since at the grant - only doc2 is sent
+	options := ChangesOptions{Since: SequenceID{Seq: 2}}
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "doc2", changes[0].ID)
+
+	// Since after the grant - nothing is sent
+	options.Since = SequenceID{Seq: 3}
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 0)
+
+	// Since within the completed backfill - not restarted
+	options.Since = SequenceID{Seq: 1, TriggeredBy: 2}
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	for _, change := range changes {
+		assert.NotEqual(t, "doc1", change.ID)
+	}
+}
+
+func TestChangesInlineUserChanges(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// User doc (sequence 1), then doc1 (sequence 2)
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Default sends the user doc entry
+	changes, err := db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+	assert.False(t, changes[1].UserAccessChanged)
+
+	// Flag is set on the following entry instead
+	options := getZeroSequence()
+	options.InlineUserChanges = true
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.True(t, changes[0].UserAccessChanged)
+
+	// Marker is sent when no entry follows the user doc
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+	db.user, _ = authenticator.GetUser("naomi")
+
+	options.Since = changes[0].Seq
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "", changes[0].ID)
+	assert.True(t, changes[0].UserAccessChanged)
+	assert.Equal(t, db.user.Sequence(), changes[0].Seq.Seq)
+
+	// The marker doesn't count towards the limit, so the following changes are still sent
+	options.Continuous = true
+	options.Wait = true
+	options.Limit = 2
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	var ids []string
+	docsAdded := false
+	for entry := range feed {
+		if entry == nil {
+			if !docsAdded {
+				for _, docID := range []string{"doc2", "doc3"} {
+					_, _, err := db.Put(docID, Body{"channels": []string{"ABC"}})
+					require.NoError(t, err)
+				}
+				docsAdded = true
+			}
+			continue
+		}
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"", "doc2", "doc3"}, ids)
+}
+
+func TestChangesAccessChangesOnly(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// User doc (sequence 1), then doc1 (sequence 2)
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC", "PBS"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Only the user doc is sent
+	options := getZeroSequence()
+	options.AccessChangesOnly = true
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+
+	// Grant PBS - the access change is sent, without the PBS backfill
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+	db.user, _ = authenticator.GetUser("naomi")
+
+	options.Since = changes[0].Seq
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+	assert.Equal(t, db.user.Sequence(), changes[0].Seq.Seq)
+
+	// Nothing further once the access change has been sent
+	options.Since = changes[0].Seq
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 0)
+}
+
+type recordingAuditSink struct {
+	lock    sync.Mutex
+	records []string
+}
+
+func (s *recordingAuditSink) Record(user, docID string, seq SequenceID, channels []string, timestamp time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records = append(s.records, fmt.Sprintf("%s:%s:%s:%v", user, docID, seq, channels))
+}
+
+func TestChangesAuditSink(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Only sent entries are recorded
+	sink := &recordingAuditSink{}
+	options := getZeroSequence()
+	options.AuditSink = sink
+	options.IncludeChannels = true
+	options.Limit = 2
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, []string{
+		"naomi:_user/naomi:1:[]",
+		"naomi:doc1:2:[ABC]",
+	}, sink.records)
+}
+
+type recordingChangesTracer struct {
+	lock   sync.Mutex
+	ctx    context.Context
+	feedID string
+	events []string
+}
+
+func (r *recordingChangesTracer) StartFeedSpan(ctx context.Context, feedID string) ChangesSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ctx = ctx
+	r.feedID = feedID
+	r.events = append(r.events, "start")
+	return r
+}
+
+func (r *recordingChangesTracer) AddEvent(name string, attributes map[string]interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, name)
+}
+
+func (r *recordingChangesTracer) End() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, "end")
+}
+
+func TestChangesTracer(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	tracer := &recordingChangesTracer{}
+	options := getZeroSequence()
+	options.Tracer = tracer
+	feed, listenerID, err := db.MultiChangesFeedWithID(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	for range feed {
+	}
+
+	// The span is ended before the feed's output is closed
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	assert.Equal(t, []string{"start", "iteration", "end"}, tracer.events)
+	assert.Equal(t, listenerID, tracer.feedID)
+	logCtx, _ := tracer.ctx.Value(base.LogContextKey{}).(base.LogContext)
+	assert.Contains(t, logCtx.CorrelationID, "changes-")
+}
+
+func TestChangesPriorityChannels(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// doc1 (sequence 1), doc2 (sequence 2) and doc4 (sequence 4) in ABC, doc3 (sequence 3) in PBS
+	for _, doc := range []struct{ id, channel string }{{"doc1", "ABC"}, {"doc2", "ABC"}, {"doc3", "PBS"}, {"doc4", "ABC"}} {
+		_, _, err := db.Put(doc.id, Body{"channels": []string{doc.channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	getIDs := func(changes []*ChangeEntry) []string {
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.ID)
+		}
+		return ids
+	}
+
+	// doc3 is sent ahead of doc2, with a low sequence preceding doc2
+	options := getZeroSequence()
+	options.PriorityChannels = []string{"PBS"}
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc1", "doc3", "doc2", "doc4"}, getIDs(changes))
+	assert.Equal(t, SequenceID{LowSeq: 1, Seq: 3}, changes[1].Seq)
+	assert.Equal(t, SequenceID{Seq: 2}, changes[2].Seq)
+
+	// Resuming from the priority entry doesn't lose doc2
+	options.Since = changes[1].Seq
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc3", "doc2", "doc4"}, getIDs(changes))
+
+	// Without priority channels, entries are sent in sequence order
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc1", "doc2", "doc3", "doc4"}, getIDs(changes))
+}
+
+func TestChangesOrder(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// doc1 (sequence 1) and doc2 (sequence 2) in ABC, zdoc3 (sequence 3) in PBS
+	for _, doc := range []struct{ id, channel string }{{"doc1", "ABC"}, {"doc2", "ABC"}, {"zdoc3", "PBS"}} {
+		_, _, err := db.Put(doc.id, Body{"channels": []string{doc.channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	getIDs := func(changes []*ChangeEntry) []string {
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.ID)
+		}
+		return ids
+	}
+
+	// Ordering by descending doc ID sends zdoc3 ahead of doc2, with a low sequence preceding doc2
+	options := getZeroSequence()
+	options.Order = func(a, b *ChangeEntry) bool {
+		return a.ID > b.ID
+	}
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc1", "zdoc3", "doc2"}, getIDs(changes))
+	assert.Equal(t, SequenceID{LowSeq: 1, Seq: 3}, changes[1].Seq)
+
+	// The default order is sequence order
+	options.Order = DefaultChangesOrder
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc1", "doc2", "zdoc3"}, getIDs(changes))
+
+	options.PriorityChannels = []string{"PBS"}
+	_, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesFairScheduling(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// a1-a4 (sequences 1-4) in the high-volume ABC, b1 (sequence 5) and b2 (sequence 6) in PBS
+	for _, doc := range []struct{ id, channel string }{{"a1", "ABC"}, {"a2", "ABC"}, {"a3", "ABC"}, {"a4", "ABC"}, {"b1", "PBS"}, {"b2", "PBS"}} {
+		_, _, err := db.Put(doc.id, Body{"channels": []string{doc.channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	getIDs := func(changes []*ChangeEntry) []string {
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.ID)
+		}
+		return ids
+	}
+
+	// In sequence order, ABC fills the limit
+	options := getZeroSequence()
+	options.Limit = 4
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3", "a4"}, getIDs(changes))
+
+	// With fair scheduling the channels take turns, with low sequences preceding the entries sent ahead of
+	options.FairScheduling = true
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "b1", "a2", "b2"}, getIDs(changes))
+	assert.Equal(t, SequenceID{LowSeq: 1, Seq: 5}, changes[1].Seq)
+	assert.Equal(t, SequenceID{LowSeq: 2, Seq: 6}, changes[3].Seq)
+
+	options.PriorityChannels = []string{"PBS"}
+	_, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesOnAccessChange(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC", "PBS"))
+	require.NoError(t, authenticator.Save(user))
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+	db.user, _ = authenticator.GetUser("naomi")
+
+	type accessChange struct{ added, removed base.Set }
+	accessChanges := make(chan accessChange, 1)
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	options.OnAccessChange = func(added, removed base.Set) {
+		accessChanges <- accessChange{added, removed}
+	}
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	// Wait for the initial user doc to be sent
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+
+	// Replace PBS with NBC
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "NBC")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+
+	select {
+	case change := <-accessChanges:
+		assert.Equal(t, base.SetOf("NBC"), change.added)
+		assert.Equal(t, base.SetOf("PBS"), change.removed)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for access change callback")
+	}
+}
+
+func TestChangesIncludeMetadata(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	revID, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc1", Body{"channels": []string{"ABC"}, BodyRev: revID})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.IncludeMetadata = true
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, 2, changes[0].RevGeneration)
+	assert.NotZero(t, changes[0].Cas)
+
+	// Absent by default
+	changes, err = db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, 0, changes[0].RevGeneration)
+	assert.Zero(t, changes[0].Cas)
+}
+
+func TestChangesConflictedEntriesStat(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// doc1 has two conflicting branches, doc2 doesn't
+	revID, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.PutExistingRevWithBody("doc1", Body{"channels": []string{"ABC"}}, []string{"2-a", revID}, false)
+	require.NoError(t, err)
+	_, _, err = db.PutExistingRevWithBody("doc1", Body{"channels": []string{"ABC"}}, []string{"2-b", revID}, false)
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Conflicts are only counted when they're included in the feed
+	_, err = db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().ConflictedEntriesCount.Value())
+
+	options := getZeroSequence()
+	options.Conflicts = true
+	_, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().ConflictedEntriesCount.Value())
+}
+
+func TestChangesSampleRate(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	const numDocs = 100
+	for i := 0; i < numDocs; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.SampleRate = 1
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	assert.Len(t, changes, numDocs)
+
+	// A sample is sent, and the feed's sequence still advances over the skipped entries
+	options.SampleRate = 0.5
+	options.EmitCaughtUp = true
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	assert.True(t, len(changes) > 1 && len(changes) <= numDocs, "Unexpected sample size %d", len(changes)-1)
+	caughtUp := changes[len(changes)-1]
+	assert.True(t, caughtUp.CaughtUp)
+	assert.Equal(t, SequenceID{Seq: numDocs}, caughtUp.Seq)
+
+	options.SampleRate = 1.5
+	_, err = db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesDocIDs(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// User doc (sequence 1), doc1 and doc2 in ABC, doc3 in PBS
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	for _, doc := range []struct{ id, channel string }{{"doc1", "ABC"}, {"doc2", "ABC"}, {"doc3", "PBS"}} {
+		_, _, err := db.Put(doc.id, Body{"channels": []string{doc.channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// doc3 isn't sent, as the user doesn't have access to it
+	options := getZeroSequence()
+	options.DocIDs = []string{"doc2", "doc3"}
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+	assert.Equal(t, "doc2", changes[1].ID)
+
+	// Skipped docs don't count towards the limit
+	options.Limit = 2
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc2", changes[1].ID)
+}
+
+func TestChangesUnordered(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// doc3 (sequence 3) is in both channels
+	for _, doc := range []struct {
+		id       string
+		channels []string
+	}{{"doc1", []string{"ABC"}}, {"doc2", []string{"PBS"}}, {"doc3", []string{"ABC", "PBS"}}, {"doc4", []string{"PBS"}}} {
+		_, _, err := db.Put(doc.id, Body{"channels": doc.channels})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Each doc is sent once, followed by a checkpoint entry
+	options := getZeroSequence()
+	options.Unordered = true
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 5)
+	ids := make([]string, 0, 4)
+	for _, change := range changes[:4] {
+		ids = append(ids, change.ID)
+	}
+	assert.ElementsMatch(t, []string{"doc1", "doc2", "doc3", "doc4"}, ids)
+	assert.Equal(t, "", changes[4].ID)
+	assert.Equal(t, SequenceID{Seq: 4}, changes[4].Seq)
+
+	// Removing doc3 from PBS sends a single entry, as it's still visible through ABC
+	doc3, err := db.Get1xBody("doc3")
+	require.NoError(t, err)
+	_, _, err = db.Put("doc3", Body{"channels": []string{"ABC"}, BodyRev: doc3[BodyRev]})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options.Since = changes[4].Seq
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc3", changes[0].ID)
+	assert.Equal(t, base.SetOf("PBS"), changes[0].Removed)
+	assert.Equal(t, SequenceID{Seq: 5}, changes[1].Seq)
+
+	// Unordered feeds can't be limited
+	options.Limit = 1
+	_, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesReportInaccessibleChannels(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// An entry is sent for each omitted channel, ahead of the feed's other entries
+	options := getZeroSequence()
+	options.ReportInaccessibleChannels = true
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS", "NBC,CBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, "", changes[0].ID)
+	assert.Equal(t, "NBC,CBS", changes[0].InaccessibleChannel)
+	assert.Equal(t, InaccessibleReasonInvalid, changes[0].InaccessibleReason)
+	assert.Equal(t, "PBS", changes[1].InaccessibleChannel)
+	assert.Equal(t, InaccessibleReasonNoAccess, changes[1].InaccessibleReason)
+	assert.Equal(t, "_user/naomi", changes[2].ID)
+	assert.Equal(t, "doc1", changes[3].ID)
+
+	// Off by default
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "", changes[0].InaccessibleChannel)
+}
+
+func TestChangesFeedThreshold(t *testing.T) {
+	assert.Equal(t, DefaultBackfillEntriesWarningThreshold, changesFeedThreshold(0, DefaultBackfillEntriesWarningThreshold))
+	assert.Equal(t, 10, changesFeedThreshold(10, DefaultBackfillEntriesWarningThreshold))
+	assert.Equal(t, -1, changesFeedThreshold(-5, DefaultBackfillEntriesWarningThreshold))
+}
+
+func TestValidateSince(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for _, docID := range []string{"doc1", "doc2"} {
+		_, _, err := db.Put(docID, Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+
+	assert.NoError(t, db.ValidateSince(SequenceID{}))
+	assert.NoError(t, db.ValidateSince(SequenceID{Seq: 2}))
+	assert.NoError(t, db.ValidateSince(SequenceID{TriggeredBy: 2, Seq: 1}))
+	assert.Error(t, db.ValidateSince(SequenceID{Seq: 3}))
+	assert.Error(t, db.ValidateSince(SequenceID{TriggeredBy: 5, Seq: 1}))
+	assert.Error(t, db.ValidateSince(SequenceID{LowSeq: 2, Seq: 1}))
+
+	// Feeds validating since end with an error entry
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+	options := getZeroSequence()
+	options.ValidateSince = true
+	options.Since = SequenceID{Seq: 10}
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+	require.Len(t, changes, 1)
+	assert.Error(t, changes[0].Err)
+}
+
+func TestChangesMinBatchSize(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for _, docID := range []string{"doc1", "doc2", "doc3"} {
+		_, _, err := db.Put(docID, Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.MinBatchSize = 2
+	options.MinBatchWait = 100 * time.Millisecond
+
+	// Only supported for continuous feeds, with a max wait
+	_, err := db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+	options.Continuous = true
+	options.MinBatchWait = 0
+	_, err = db.MultiChangesFeed(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+
+	options.MinBatchWait = 100 * time.Millisecond
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	start := time.Now()
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	// doc1 and doc2 are sent as a batch, and the remaining doc3 once MinBatchWait has elapsed, followed by the
+	// waiting marker
+	var ids []string
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"doc1", "doc2", "doc3"}, ids)
+	assert.True(t, time.Since(start) >= options.MinBatchWait)
+}
+
+func TestChangesRemovalReasons(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// docRemoved is reassigned from ABC to PBS, docDeleted is deleted, and docMoved is removed from both ABC and NBC
+	revID, _, err := db.Put("docRemoved", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("docRemoved", Body{"channels": []string{"PBS"}, BodyRev: revID})
+	require.NoError(t, err)
+	revID, _, err = db.Put("docDeleted", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, err = db.DeleteDoc("docDeleted", revID)
+	require.NoError(t, err)
+	revID, _, err = db.Put("docMoved", Body{"channels": []string{"ABC", "NBC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("docMoved", Body{"channels": []string{"PBS"}, BodyRev: revID})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.IncludeRemovalReasons = true
+	changes, err := db.GetChanges(base.SetOf("ABC", "NBC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+
+	reasons := make(map[string]map[string]RemovalReason, len(changes))
+	for _, change := range changes {
+		reasons[change.ID] = change.RemovalReasons
+	}
+	assert.Equal(t, map[string]RemovalReason{"ABC": RemovalReasonChannelChange}, reasons["docRemoved"])
+	assert.Equal(t, map[string]RemovalReason{"ABC": RemovalReasonDeleted}, reasons["docDeleted"])
+	assert.Equal(t, map[string]RemovalReason{"ABC": RemovalReasonChannelChange, "NBC": RemovalReasonChannelChange}, reasons["docMoved"])
+
+	// Reasons aren't set unless requested
+	options.IncludeRemovalReasons = false
+	changes, err = db.GetChanges(base.SetOf("ABC", "NBC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	for _, change := range changes {
+		assert.NotNil(t, change.Removed)
+		assert.Nil(t, change.RemovalReasons)
+	}
+}
+
+func TestChangesMaxRemovedChannels(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+	db.Options.ChangesFeedOptions.MaxRemovedChannels = 2
+
+	revID, _, err := db.Put("doc1", Body{"channels": []string{"ABC", "NBC", "PBS"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc1", Body{"channels": []string{"CBS"}, BodyRev: revID})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.IncludeRemovalReasons = true
+	changes, err := db.GetChanges(base.SetOf("ABC", "NBC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, base.SetOf("ABC", "NBC"), changes[0].Removed)
+	assert.Len(t, changes[0].RemovalReasons, 2)
+	assert.True(t, changes[0].RemovedTruncated)
+	assert.Equal(t, int64(3), db.DbStats.ChangesFeed().RemovedChannelsMax.Value())
+
+	// Without a limit, the full set is sent
+	db.Options.ChangesFeedOptions.MaxRemovedChannels = 0
+	changes, err = db.GetChanges(base.SetOf("ABC", "NBC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, base.SetOf("ABC", "NBC", "PBS"), changes[0].Removed)
+	assert.False(t, changes[0].RemovedTruncated)
+	assert.Equal(t, int64(3), db.DbStats.ChangesFeed().RemovedChannelsMax.Value())
+
+	// A smaller Removed set doesn't lower the max
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, base.SetOf("ABC"), changes[0].Removed)
+	assert.Equal(t, int64(3), db.DbStats.ChangesFeed().RemovedChannelsMax.Value())
+}
+
+func TestChangesChannelNormalizer(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "Tenant42"))
+	require.NoError(t, authenticator.Save(user))
+	_, _, err := db.Put("doc1", Body{"channels": []string{"Tenant42"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	getIDs := func() []string {
+		changes, err := db.GetChanges(base.SetOf(" tenant42"), getZeroSequence())
+		require.NoError(t, err)
+		ids := make([]string, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.ID)
+		}
+		return ids
+	}
+
+	// Without normalization, the requested channel doesn't match the grant
+	assert.Equal(t, []string{"_user/naomi"}, getIDs())
+
+	db.ChannelNormalizer = func(channel string) string {
+		return strings.ToLower(strings.TrimSpace(channel))
+	}
+	assert.Equal(t, []string{"_user/naomi", "doc1"}, getIDs())
+}
+
+func TestChangesIncludeChannels(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC", "PBS"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Channels aren't set by default
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Nil(t, changes[0].Channels)
+
+	// Entries found in more than one channel list all of them
+	options := getZeroSequence()
+	options.IncludeChannels = true
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.Equal(t, []string{"ABC", "PBS"}, changes[0].Channels)
+	assert.Equal(t, "doc2", changes[1].ID)
+	assert.Equal(t, []string{"PBS"}, changes[1].Channels)
+}
+
+func TestMultiChangesFeedSinceAny(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	for i := 1; i <= 5; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Three devices with divergent checkpoints - changes are sent after the earliest
+	options := getZeroSequence()
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeedSinceAny(base.SetOf("ABC"), options, []SequenceID{{Seq: 4}, {Seq: 2}, {Seq: 5}})
+	require.NoError(t, err)
+
+	var ids []string
+	for entry := range feed {
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"doc3", "doc4", "doc5"}, ids)
+}
+
+func TestChangesDeltaHints(t *testing.T) {
+
+	db := setupTestDBWithOptions(t, DatabaseContextOptions{
+		DeltaSyncOptions: DeltaSyncOptions{
+			Enabled:          true,
+			RevMaxAgeSeconds: DefaultDeltaSyncRevMaxAge,
+		},
+	})
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	rev1ID, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc1", Body{"channels": []string{"ABC"}, "value": 2, BodyRev: rev1ID})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.DeltaHints = true
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.True(t, changes[0].DeltaAvailable)
+	// No parent revision for a delta
+	assert.Equal(t, "doc2", changes[1].ID)
+	assert.False(t, changes[1].DeltaAvailable)
+
+	// Parent revision is no longer cached
+	db.FlushRevisionCacheForTest()
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.False(t, changes[0].DeltaAvailable)
+}
+
+func TestChangesFeedLoggingCopy(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.Ctx = context.WithValue(context.Background(), base.LogContextKey{}, base.LogContext{CorrelationID: "#001", TestName: t.Name()})
+	feedDB := db.changesFeedLoggingCopy("0c6f1d2e-8b5a-4f0e-9d3c-2a1b0c9d8e7f")
+
+	logCtx, ok := feedDB.Ctx.Value(base.LogContextKey{}).(base.LogContext)
+	require.True(t, ok)
+	assert.Equal(t, "#001-changes-0c6f1d2e", logCtx.CorrelationID)
+	assert.Equal(t, t.Name(), logCtx.TestName)
+
+	// The original database's log context is unchanged
+	logCtx = db.Ctx.Value(base.LogContextKey{}).(base.LogContext)
+	assert.Equal(t, "#001", logCtx.CorrelationID)
+
+	// Feeds without a request log context are still identified
+	db.Ctx = nil
+	feedDB = db.changesFeedLoggingCopy("0c6f1d2e-8b5a-4f0e-9d3c-2a1b0c9d8e7f")
+	logCtx = feedDB.Ctx.Value(base.LogContextKey{}).(base.LogContext)
+	assert.Equal(t, "changes-0c6f1d2e", logCtx.CorrelationID)
+}
+
+func TestChangesExpandedChannelsStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.GetChanges(base.SetOf("ABC", "PBS", "NBC"), getZeroSequence())
+	require.NoError(t, err)
+	_, err = db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), db.DbStats.ChangesFeed().ExpandedChannelsCount.Value())
+	assert.Equal(t, int64(3), db.DbStats.ChangesFeed().ExpandedChannelsMax.Value())
+}
+
+func TestChangesMaxConcurrentFeeds(t *testing.T) {
+
+	cacheOptions := DefaultCacheOptions()
+	db := setupTestDBWithOptions(t, DatabaseContextOptions{
+		CacheOptions:       &cacheOptions,
+		ChangesFeedOptions: ChangesFeedOptions{MaxConcurrentFeeds: 1},
+	})
+	defer db.Close()
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().MaxConcurrentFeeds.Value())
+
+	// A continuous feed holds the only slot
+	activeTerminator := make(chan bool)
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Terminator = activeTerminator
+	activeFeed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumActiveFeeds.Value, 1)
+	require.True(t, ok)
+
+	// Without a wait, the next feed is rejected
+	_, err = db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().NumFeedsRejected.Value())
+
+	// A feed waiting for a slot closes as soon as it's terminated, without being counted as rejected
+	db.Options.ChangesFeedOptions.MaxConcurrentFeedsWait = time.Minute
+	waitingTerminator := make(chan bool)
+	options = getZeroSequence()
+	options.Terminator = waitingTerminator
+	waitingFeed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	close(waitingTerminator)
+	select {
+	case entry, ok := <-waitingFeed:
+		assert.False(t, ok, "Unexpected entry %v", entry)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for terminated feed to close")
+	}
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().NumFeedsRejected.Value())
+
+	// A waiting feed is admitted once the active feed releases its slot
+	done := make(chan error)
+	go func() {
+		_, err := db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+		done <- err
+	}()
+	close(activeTerminator)
+	for range activeFeed {
+	}
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for feed to be admitted")
+	}
+	_, ok = base.WaitForStat(db.DbStats.ChangesFeed().NumActiveFeeds.Value, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().NumFeedsRejected.Value())
+}
+
+func TestChangesDrainOnTerminate(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// More docs than fit in the feed's output buffer
+	for i := 1; i <= 60; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	terminator := make(chan bool)
+	options := getZeroSequence()
+	options.Terminator = terminator
+	options.DrainOnTerminate = true
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	// Wait for the feed to block on its full output buffer, then terminate it without reading
+	_, ok := base.WaitForStat(func() int64 { return int64(len(feed)) }, int64(cap(feed)))
+	require.True(t, ok)
+	close(terminator)
+
+	// The feed exits without waiting for the consumer, leaving the merged entries in the output buffer
+	_, ok = base.WaitForStat(db.DbStats.ChangesFeed().NumActiveFeeds.Value, 0)
+	require.True(t, ok)
+
+	var lastSeq uint64
+	var count int
+	for entry := range feed {
+		require.Nil(t, entry.Err)
+		assert.Equal(t, lastSeq+1, entry.Seq.Seq)
+		lastSeq = entry.Seq.Seq
+		count++
+	}
+	assert.Equal(t, cap(feed), count)
+}
+
+func TestChangesFeedGoroutineStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// The feed goroutine, plus one per channel feed
+	_, err := db.GetChanges(base.SetOf("ABC", "PBS", "NBC"), getZeroSequence())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), db.DbStats.ChangesFeed().FeedGoroutinesMax.Value())
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Value())
+
+	// Unordered feeds also forward each channel feed's entries
+	options := getZeroSequence()
+	options.Unordered = true
+	_, err = db.GetChanges(base.SetOf("ABC", "PBS", "NBC"), options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), db.DbStats.ChangesFeed().FeedGoroutinesMax.Value())
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Value())
+}
+
+func TestWriteChangesNDJSON(t *testing.T) {
+
+	newFeed := func() <-chan *ChangeEntry {
+		feed := make(chan *ChangeEntry, 3)
+		feed <- &ChangeEntry{Seq: SequenceID{Seq: 1}, ID: "doc1", Changes: []ChangeRev{{"rev": "1-a"}}}
+		feed <- nil
+		feed <- &ChangeEntry{Seq: SequenceID{Seq: 3, TriggeredBy: 5}, ID: "doc2", Changes: []ChangeRev{{"rev": "1-b"}}}
+		close(feed)
+		return feed
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChangesNDJSON(newFeed(), &buf, nil))
+	assert.Equal(t, `{"seq":1,"id":"doc1","changes":[{"rev":"1-a"}]}`+"\n"+
+		`{"seq":"5:3","id":"doc2","changes":[{"rev":"1-b"}]}`+"\n", buf.String())
+
+	// Keepalive line is written for nil entries
+	buf.Reset()
+	require.NoError(t, WriteChangesNDJSON(newFeed(), &buf, []byte("{}")))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "{}", lines[1])
+}
+
+func TestWriteChangesNDJSONGzip(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	feed := make(chan *ChangeEntry, 2)
+	feed <- &ChangeEntry{Seq: SequenceID{Seq: 1}, ID: "doc1", Changes: []ChangeRev{{"rev": "1-a"}}}
+	feed <- &ChangeEntry{Seq: SequenceID{Seq: 2}, ID: "doc2", Changes: []ChangeRev{{"rev": "1-b"}}}
+	close(feed)
+
+	var buf bytes.Buffer
+	require.NoError(t, db.WriteChangesNDJSONGzip(feed, &buf, nil))
+	compressedLen := buf.Len()
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, `{"seq":1,"id":"doc1","changes":[{"rev":"1-a"}]}`+"\n"+
+		`{"seq":2,"id":"doc2","changes":[{"rev":"1-b"}]}`+"\n", string(uncompressed))
+
+	assert.Equal(t, int64(compressedLen), db.DbStats.ChangesFeed().GzipBytes.Value())
+	assert.Equal(t, int64(len(uncompressed)), db.DbStats.ChangesFeed().GzipBytesUncompressed.Value())
+}
+
+func TestChangesWakeupJitter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), changesWakeupJitter(0))
+	for i := 0; i < 100; i++ {
+		jitter := changesWakeupJitter(10 * time.Millisecond)
+		assert.True(t, jitter >= 0 && jitter < 10*time.Millisecond, "Unexpected jitter %v", jitter)
+	}
+}
+
+func TestChangesBackfillMarkers(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// Create a user with access to channel ABC
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// Create a doc on two channels (sequence 1):
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC", "PBS"}})
+	require.NoError(t, err)
+
+	// Grant the user access to PBS (sequence 2):
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Markers aren't sent unless requested
+	changes, err := db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	for _, change := range changes {
+		assert.Nil(t, change.BackfillComplete)
+	}
+
+	options := getZeroSequence()
+	options.BackfillMarkers = true
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	printChanges(changes)
+	require.Len(t, changes, 4)
+
+	// doc1 from ABC, then the PBS backfill, followed by the marker and the user doc
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.Equal(t, "doc1", changes[1].ID)
+	assert.True(t, changes[1].Seq.TriggeredBy > 0)
+	assert.Equal(t, "", changes[2].ID)
+	assert.Equal(t, base.SetOf("PBS"), changes[2].BackfillComplete)
+	assert.Equal(t, SequenceID{Seq: 2, TriggeredBy: 2}, changes[2].Seq)
+	assert.Equal(t, "_user/naomi", changes[3].ID)
+
+	// Resuming from the marker doesn't repeat it
+	options.Since = changes[2].Seq
+	changes, err = db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+}
+
+func TestChangesNumFeedsInBackfill(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// More PBS docs than fit in the feed's output buffer, so that the feed blocks during backfill
+	numDocs := 60
+	for i := 0; i < numDocs; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"PBS"}})
+		require.NoError(t, err)
+	}
+
+	// Grant the user access to PBS
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+	db.user, _ = authenticator.GetUser("naomi")
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumFeedsInBackfill.Value, 1)
+	require.True(t, ok)
+
+	// Once backfill has been sent and the feed is waiting for changes, it's no longer counted
+	backfilled := 0
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+		if entry.Seq.TriggeredBy > 0 {
+			backfilled++
+		}
+	}
+	assert.Equal(t, numDocs, backfilled)
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().NumFeedsInBackfill.Value())
+}
+
+func TestChangesBackfillCaseStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// doc1 (sequence 1) and doc2 (sequence 2) in PBS, then grant PBS (sequence 3)
+	_, _, err := db.Put("doc1", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+	stats := db.DbStats.ChangesFeed()
+
+	// Starting from zero initiates the PBS backfill, other channels don't require backfill
+	_, err = db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.BackfillNewCount.Value())
+	assert.Equal(t, int64(0), stats.BackfillInProgressCount.Value())
+	noneCount := stats.BackfillNoneCount.Value()
+	assert.True(t, noneCount > 0)
+
+	// Resuming partway through the PBS backfill
+	options := ChangesOptions{Since: SequenceID{Seq: 1, TriggeredBy: 3}}
+	changes, err := db.GetChanges(base.SetOf("*"), options)
+	require.NoError(t, err)
+	require.True(t, len(changes) > 0)
+	assert.Equal(t, "doc2", changes[0].ID)
+	assert.Equal(t, int64(1), stats.BackfillNewCount.Value())
+	assert.Equal(t, int64(1), stats.BackfillInProgressCount.Value())
+	assert.True(t, stats.BackfillNoneCount.Value() > noneCount)
+}
+
+func TestBackfillEntryCount(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// doc1 (sequence 1) and doc2 (sequence 2) in PBS, then grant PBS (sequence 3), then doc3 (sequence 4) in PBS
+	_, _, err := db.Put("doc1", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	_, _, err = db.Put("doc3", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// The count matches the entries the feed sends as backfill
+	count, err := db.BackfillEntryCount("PBS", SequenceID{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	changes, err := db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	backfilled := 0
+	for _, change := range changes {
+		if change.Seq.TriggeredBy > 0 {
+			backfilled++
+		}
+	}
+	assert.Equal(t, count, backfilled)
+
+	testCases := []struct {
+		name     string
+		channel  string
+		since    SequenceID
+		expected int
+	}{
+		{"resuming backfill", "PBS", SequenceID{Seq: 1, TriggeredBy: 3}, 1},
+		{"after grant", "PBS", SequenceID{Seq: 3}, 0},
+		{"resuming later backfill", "PBS", SequenceID{Seq: 1, TriggeredBy: 5}, 0},
+		{"channel granted at creation", "ABC", SequenceID{}, 0},
+		{"inaccessible channel", "NBC", SequenceID{}, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			count, err := db.BackfillEntryCount(tc.channel, tc.since)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, count)
+		})
+	}
+}
+
+func TestChangesTerminateDuringBackfill(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+
+	// Backfill of PBS is larger than the feed's output buffer
+	const numDocs = 200
+	for i := 0; i < numDocs; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"PBS"}})
+		require.NoError(t, err)
+	}
+	userInfo, err := db.GetPrincipal("naomi", true)
+	require.NoError(t, err)
+	userInfo.ExplicitChannels = base.SetOf("ABC", "PBS")
+	_, err = db.UpdatePrincipal(*userInfo, true, true)
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+	goroutines := runtime.NumGoroutine()
+
+	options := getZeroSequence()
+	options.Terminator = make(chan bool)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	// Terminate after the first backfilled entry
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.True(t, entry.Seq.TriggeredBy > 0)
+	close(options.Terminator)
+
+	// Only entries already buffered are received before the feed is closed
+	received := 1
+	closed := make(chan struct{})
+	go func() {
+		for range feed {
+			received++
+		}
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Feed wasn't closed after being terminated during backfill")
+	}
+	assert.True(t, received < numDocs, "Expected the remaining backfill not to be sent, got %d entries", received)
+
+	// The feed's goroutines, including the channel feeds, have exited
+	_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Value, 0)
+	assert.True(t, ok)
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= goroutines, "Expected at most %d goroutines, got %d", goroutines, runtime.NumGoroutine())
+}
+
+func TestChangesAbandonedConsumer(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// More changes than fit in the feed's output buffer, across several channel feeds
+	const numDocs = 300
+	for i := 0; i < numDocs; i++ {
+		channel := []string{"ABC", "PBS", "NBC"}[i%3]
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	testCases := []struct {
+		name        string
+		sendTimeout time.Duration
+		terminate   func(listenerID string) // Called once the consumer has stopped reading
+	}{
+		{"send timeout", 50 * time.Millisecond, func(string) {}},
+		{"cancelled", 0, func(listenerID string) {
+			assert.True(t, db.CancelChangeListener(listenerID))
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			goroutines := runtime.NumGoroutine()
+
+			options := getZeroSequence()
+			options.Continuous = true
+			options.Wait = true
+			options.Terminator = make(chan bool)
+			defer close(options.Terminator)
+			options.SendTimeout = tc.sendTimeout
+			feed, listenerID, err := db.MultiChangesFeedWithID(base.SetOf("ABC", "PBS", "NBC"), options)
+			require.NoError(t, err)
+
+			// The consumer stops reading after the first entry, without closing the terminator
+			require.NotNil(t, <-feed)
+			tc.terminate(listenerID)
+
+			// The feed goroutine and all of its channel feed goroutines exit
+			_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumActiveFeedGoroutines.Value, 0)
+			assert.True(t, ok)
+			for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			assert.True(t, runtime.NumGoroutine() <= goroutines, "Expected at most %d goroutines, got %d", goroutines, runtime.NumGoroutine())
+		})
+	}
+}
+
+func TestChangesDescending(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 5; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Descending = true
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 5)
+	for i, change := range changes {
+		assert.Equal(t, fmt.Sprintf("doc%d", 5-i), change.ID)
+	}
+
+	// Limit returns the most recent entries
+	options.Limit = 2
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc5", changes[0].ID)
+	assert.Equal(t, "doc4", changes[1].ID)
+
+	// Not supported for continuous feeds
+	options.Continuous = true
+	_, err = db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesGroupByChannel(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// Sequences alternate between channels ABC and PBS
+	for i := 1; i <= 6; i++ {
+		channel := "ABC"
+		if i%2 == 0 {
+			channel = "PBS"
+		}
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.GroupByChannel = true
+	options.GroupByWindow = 4
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	var ids []string
+	for _, change := range changes {
+		ids = append(ids, change.ID)
+	}
+	assert.Equal(t, []string{"doc1", "doc3", "doc2", "doc4", "doc5", "doc6"}, ids)
+	assert.Equal(t, []string{"ABC"}, changes[0].Channels)
+
+	// Not supported for continuous feeds
+	options.Continuous = true
+	_, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	assert.Error(t, err)
+}
+
+func TestChangesSinceNow(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Existing changes aren't sent
+	options := ChangesOptions{SinceNow: true}
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	assert.Len(t, changes, 0)
+
+	// Changes after feed start are sent
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Nil(t, <-feed) // Waiting
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, "doc2", entry.ID)
+
+	// SinceNow can't be combined with Since
+	options = ChangesOptions{SinceNow: true, Since: SequenceID{Seq: 1}}
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	assert.Error(t, err)
+	require.Len(t, changes, 1)
+	assert.NotNil(t, changes[0].Err)
+}
+
+func TestGuestChanges(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"PBS"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	setGuestChannels := func(chans ...string) {
+		guestInfo, err := db.GetPrincipal("", true)
+		require.NoError(t, err)
+		guestInfo.ExplicitChannels = base.SetOf(chans...)
+		_, err = db.UpdatePrincipal(*guestInfo, true, true)
+		require.NoError(t, err)
+		db.user, err = db.Authenticator().GetUser("")
+		require.NoError(t, err)
+	}
+
+	// Guest with access to a single channel
+	setGuestChannels("ABC")
+	changes, err := db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "doc1", changes[0].ID)
+
+	// Wildcard channel expansion for a guest with access to all channels.  The guest user doc isn't included.
+	setGuestChannels("*")
+	changes, err = db.GetChanges(base.SetOf("*"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc1", changes[0].ID)
+	assert.Equal(t, "doc2", changes[1].ID)
+}
+
+func TestChangesLimitTruncatedStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Interleave docs across two channels (sequences 1-4)
+	for i, channel := range []string{"ABC", "PBS", "ABC", "PBS"} {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{channel}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Unlimited and non-truncating feeds don't update the stats
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	options := getZeroSequence()
+	options.Limit = 4
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().LimitTruncatedFeeds.Value())
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().LimitTruncatedEntries.Value())
+
+	// When the limit is hit the merger has already read the next entry from ABC
+	options.Limit = 2
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().LimitTruncatedFeeds.Value())
+	assert.True(t, db.DbStats.ChangesFeed().LimitTruncatedEntries.Value() >= 1)
+}
+
+func TestChangesChannelPattern(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "tenant-42-a", "Tenant-42-b", "tenant-7-a"))
+	require.NoError(t, authenticator.Save(user))
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"tenant-42-a"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"Tenant-42-b"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc3", Body{"channels": []string{"tenant-7-a"}})
+	require.NoError(t, err)
+	_, _, err = db.Put("doc4", Body{"channels": []string{"tenant-42-c"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	db.user, _ = authenticator.GetUser("naomi")
+
+	// Pattern is only expanded against the user's channels
+	options := getZeroSequence()
+	options.ChannelPattern, err = CompileChannelPattern("(?i)tenant-42-.*")
+	require.NoError(t, err)
+	changes, err := db.GetChanges(base.Set{}, options)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+	assert.Equal(t, "doc1", changes[1].ID)
+	assert.Equal(t, "doc2", changes[2].ID)
+
+	// Pattern must match the whole channel name, and is combined with explicitly requested channels
+	options.ChannelPattern, err = CompileChannelPattern("tenant-42")
+	require.NoError(t, err)
+	changes, err = db.GetChanges(base.SetOf("tenant-7-a"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "_user/naomi", changes[0].ID)
+	assert.Equal(t, "doc3", changes[1].ID)
+
+	_, err = CompileChannelPattern("tenant-(")
+	assert.Error(t, err)
+	_, err = CompileChannelPattern(strings.Repeat("a", maxChannelPatternLength+1))
+	assert.Error(t, err)
+}
+
+func TestActiveChangeListeners(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	authenticator := db.Authenticator()
+	user, _ := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "ABC"))
+	require.NoError(t, authenticator.Save(user))
+	db.user, _ = authenticator.GetUser("naomi")
+
+	assert.Len(t, db.ActiveChangeListeners(), 0)
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	// Read until the feed is waiting for changes
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+
+	listeners := db.ActiveChangeListeners()
+	require.Len(t, listeners, 1)
+	assert.NotEmpty(t, listeners[0].ID)
+	assert.Equal(t, "naomi", listeners[0].User)
+	assert.True(t, listeners[0].Channels.Contains("ABC"))
+	assert.True(t, listeners[0].Continuous)
+
+	// Wake the waiting feed so that it notices termination
+	close(options.Terminator)
+	db.NotifyTerminatedChanges("naomi")
+	for range feed {
+	}
+	assert.Len(t, db.ActiveChangeListeners(), 0)
+}
+
+func TestChangeListenerDebugSnapshot(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, listenerID, err := db.MultiChangesFeedWithID(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+
+	// The waiting feed's first iteration has merged everything from its closed channel feed
+	snapshot, ok := db.ChangeListenerDebugSnapshot(listenerID)
+	require.True(t, ok)
+	assert.Equal(t, listenerID, snapshot.ID)
+	assert.Equal(t, uint64(1), snapshot.Iterations)
+	assert.Equal(t, SequenceID{}, snapshot.IterationSince)
+	require.Len(t, snapshot.ChannelFeeds, 1)
+	assert.Equal(t, "ABC", snapshot.ChannelFeeds[0].Channel)
+	assert.False(t, snapshot.ChannelFeeds[0].Open)
+	assert.Nil(t, snapshot.ChannelFeeds[0].Current)
+
+	_, ok = db.ChangeListenerDebugSnapshot("unknown")
+	assert.False(t, ok)
+}
+
+func TestChangesSendBlockedFraction(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// More docs than fit in the feed's output buffer, so that the feed blocks on the slow consumer
+	for i := 0; i < 60; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"value": i})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+	assert.True(t, db.DbStats.ChangesFeed().SendBlockedTime.Value() > 0)
+
+	// The listener is updated once the feed has sent the nil entry
+	var fraction float64
+	for i := 0; i < 100; i++ {
+		listeners := db.ActiveChangeListeners()
+		require.Len(t, listeners, 1)
+		if fraction = listeners[0].SendBlockedFraction; fraction > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, fraction > 0.5, "Unexpected send blocked fraction %v", fraction)
+	assert.True(t, fraction <= 1)
+}
+
+func TestChangesPauseResume(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"value": i})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Pause before the first entry is sent
+	pause := make(chan struct{}, 1)
+	resume := make(chan struct{})
+	pause <- struct{}{}
+	options := getZeroSequence()
+	options.PauseSignal = pause
+	options.ResumeSignal = resume
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+
+	select {
+	case entry := <-feed:
+		t.Fatalf("Unexpected entry from paused feed: %v", entry)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	resume <- struct{}{}
+	var ids []string
+	for entry := range feed {
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"doc0", "doc1", "doc2"}, ids)
+
+	// A paused feed is terminated promptly
+	pause <- struct{}{}
+	options.Terminator = make(chan bool)
+	feed, err = db.MultiChangesFeed(base.SetOf("*"), options)
+	require.NoError(t, err)
+	close(options.Terminator)
+	select {
+	case _, ok := <-feed:
+		assert.False(t, ok)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for paused feed to terminate")
+	}
+}
+
+func TestCancelChangeListener(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, id, err := db.MultiChangesFeedWithID(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	// Read until the feed is waiting for changes
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+
+	assert.False(t, db.CancelChangeListener("unknown"))
+	assert.True(t, db.CancelChangeListener(id))
+
+	// Feed is closed without the caller's terminator being closed
+	for range feed {
+	}
+	assert.Len(t, db.ActiveChangeListeners(), 0)
+	assert.False(t, db.CancelChangeListener(id))
+}
+
+func TestChangesMaxDuration(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.MaxDuration = 100 * time.Millisecond
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	startTime := time.Now()
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	// Existing changes are sent, then the feed is closed while waiting, without the caller's terminator being closed
+	var ids []string
+	for entry := range feed {
+		if entry != nil {
+			ids = append(ids, entry.ID)
+		}
+	}
+	assert.Equal(t, []string{"doc1"}, ids)
+	assert.True(t, time.Since(startTime) >= options.MaxDuration)
+}
+
+func TestChangesStatsInterval(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.StatsInterval = 50 * time.Millisecond
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+		assert.Nil(t, entry.FeedStats)
+	}
+
+	// The stats entry that came due while waiting is sent on wakeup, ahead of doc2
+	time.Sleep(2 * options.StatsInterval)
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, "", entry.ID)
+	assert.Equal(t, &ChangesFeedProgress{EntriesSent: 1, Wakeups: 1}, entry.FeedStats)
+	entry = <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, "doc2", entry.ID)
+}
+
+func TestChangesEmitCaughtUp(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for _, docID := range []string{"doc1", "doc2"} {
+		_, _, err := db.Put(docID, Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.EmitCaughtUp = true
+	changes, err := db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.False(t, changes[1].CaughtUp)
+	assert.True(t, changes[2].CaughtUp)
+	assert.Equal(t, "", changes[2].ID)
+	assert.Equal(t, SequenceID{Seq: 2}, changes[2].Seq)
+
+	// A feed stopped by Limit hasn't caught up
+	options.Limit = 1
+	changes, err = db.GetChanges(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].CaughtUp)
+}
+
+func TestChangesIdleTimeout(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.IdleTimeout = 100 * time.Millisecond
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, listenerID, err := db.MultiChangesFeedWithID(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+
+	// Acknowledged heartbeats keep the waiting feed open past the idle timeout
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+	for i := 0; i < 10; i++ {
+		time.Sleep(20 * time.Millisecond)
+		db.changeListeners.touch(listenerID)
+	}
+	assert.Len(t, db.ActiveChangeListeners(), 1)
+
+	// Once they stop, the feed is closed without the caller's terminator being closed
+	for range feed {
+	}
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().IdleFeedsReclaimed.Value())
+}
+
+func TestChangesFirstEntryStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i := 1; i <= 3; i++ {
+		_, _, err := db.Put(fmt.Sprintf("doc%d", i), Body{"channels": []string{"ABC"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	// Time to first entry is recorded once per feed
+	changes, err := db.GetChanges(base.SetOf("ABC"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().FirstEntryCount.Value())
+	firstEntryTime := db.DbStats.ChangesFeed().FirstEntryTime.Value()
+	assert.True(t, firstEntryTime > 0)
+
+	// A feed that sends nothing doesn't record it
+	changes, err = db.GetChanges(base.SetOf("PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 0)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().FirstEntryCount.Value())
+	assert.Equal(t, firstEntryTime, db.DbStats.ChangesFeed().FirstEntryTime.Value())
+}
+
+func TestChangesWakeupStats(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().NumWakeups.Value())
+
+	// A wakeup without anything to send isn't productive
+	db.mutationListener.Notify(base.SetOf("ABC"))
+	_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumWakeups.Value, 1)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), db.DbStats.ChangesFeed().NumProductiveWakeups.Value())
+
+	// A wakeup for a new doc is
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, "doc2", entry.ID)
+	_, ok = base.WaitForStat(db.DbStats.ChangesFeed().NumProductiveWakeups.Value, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), db.DbStats.ChangesFeed().NumWakeups.Value())
+}
+
+func TestChangesSkipNoOpWakeup(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.Put("doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(context.Background()))
+
+	options := getZeroSequence()
+	options.Continuous = true
+	options.Wait = true
+	options.Terminator = make(chan bool)
+	defer close(options.Terminator)
+	feed, err := db.MultiChangesFeed(base.SetOf("ABC"), options)
+	require.NoError(t, err)
+	for entry := range feed {
+		if entry == nil {
+			break
+		}
+	}
+
+	// A notification with nothing new in the cache doesn't re-run the iteration
+	db.mutationListener.Notify(base.SetOf("ABC"))
+	_, ok := base.WaitForStat(db.DbStats.ChangesFeed().NumSkippedWakeups.Value, 1)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().NumWakeups.Value())
+
+	// A new doc does
+	_, _, err = db.Put("doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, "doc2", entry.ID)
+	assert.Equal(t, int64(1), db.DbStats.ChangesFeed().NumSkippedWakeups.Value())
+}
+
 // Benchmark to validate fix for https://github.com/couchbase/sync_gateway/issues/2428
 func BenchmarkChangesFeedDocUnmarshalling(b *testing.B) {
 	defer base.SetUpBenchmarkLogging(base.LevelWarn, base.KeyHTTP)()
@@ -431,3 +2755,284 @@ func BenchmarkChangesFeedDocUnmarshalling(b *testing.B) {
 	}
 
 }
+
+// Benchmarks merging channel feeds where every sequence is present in all channels.  For each sequence, all but one
+// of the entries are discarded during merge and recycled via changeEntryPool, so allocs/op should be dominated by
+// the entries handed to the consumer.
+func BenchmarkChangesMergerSharedSequences(b *testing.B) {
+	const numFeeds = 10
+	const numSequences = 100
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		feeds := make([]<-chan *ChangeEntry, numFeeds)
+		for f := range feeds {
+			feed := make(chan *ChangeEntry, 1)
+			go func() {
+				for seq := uint64(1); seq <= numSequences; seq++ {
+					entry := getChangeEntry()
+					entry.Seq = SequenceID{Seq: seq}
+					entry.ID = "doc1"
+					feed <- entry
+				}
+				close(feed)
+			}()
+			feeds[f] = feed
+		}
+
+		merger := newChangesMerger(feeds)
+		for entry := merger.next(); entry != nil; entry = merger.next() {
+		}
+	}
+}
+
+// Channel cache that fails the first failures calls to GetChanges
+type failingChannelCache struct {
+	*fakeSingleChannelCache
+	failures int
+}
+
+func (c *failingChannelCache) GetChanges(options ChangesOptions) ([]*LogEntry, error) {
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("injected query failure")
+	}
+	return c.fakeSingleChannelCache.GetChanges(options)
+}
+
+func TestChangesMergerRemovedUnion(t *testing.T) {
+	// Entries for doc1 at sequence 5, keyed by the channel of the feed they're sent on.  A nil removed set is a
+	// regular (non-removal) entry.
+	testCases := []struct {
+		name               string
+		feeds              []base.Set
+		expectedRemoved    base.Set
+		expectedAllRemoved bool
+	}{
+		{
+			name:               "single channel removal",
+			feeds:              []base.Set{base.SetOf("ABC")},
+			expectedRemoved:    base.SetOf("ABC"),
+			expectedAllRemoved: true,
+		},
+		{
+			name:               "removal in one of several channels",
+			feeds:              []base.Set{base.SetOf("ABC"), nil},
+			expectedRemoved:    base.SetOf("ABC"),
+			expectedAllRemoved: false,
+		},
+		{
+			name:               "simultaneous removal from several channels",
+			feeds:              []base.Set{base.SetOf("ABC"), base.SetOf("PBS"), base.SetOf("NBC")},
+			expectedRemoved:    base.SetOf("ABC", "PBS", "NBC"),
+			expectedAllRemoved: true,
+		},
+		{
+			name:               "min entry isn't a removal",
+			feeds:              []base.Set{nil, base.SetOf("PBS")},
+			expectedRemoved:    base.SetOf("PBS"),
+			expectedAllRemoved: false,
+		},
+		{
+			name:               "min entry isn't a removal, removed from several channels",
+			feeds:              []base.Set{nil, base.SetOf("PBS"), base.SetOf("NBC")},
+			expectedRemoved:    base.SetOf("PBS", "NBC"),
+			expectedAllRemoved: false,
+		},
+		{
+			name:               "no removals",
+			feeds:              []base.Set{nil, nil},
+			expectedRemoved:    nil,
+			expectedAllRemoved: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			feeds := make([]<-chan *ChangeEntry, 0, len(tc.feeds))
+			for _, removed := range tc.feeds {
+				feed := make(chan *ChangeEntry, 2)
+				feed <- &ChangeEntry{Seq: SequenceID{Seq: 5}, ID: "doc1", Changes: []ChangeRev{{"rev": "2-a"}}, Removed: removed}
+				feed <- &ChangeEntry{Seq: SequenceID{Seq: 6}, ID: "doc2", Changes: []ChangeRev{{"rev": "1-a"}}}
+				close(feed)
+				feeds = append(feeds, feed)
+			}
+
+			merger := newChangesMerger(feeds)
+			entry := merger.next()
+			require.NotNil(t, entry)
+			assert.Equal(t, "doc1", entry.ID)
+			assert.Equal(t, tc.expectedRemoved, entry.Removed)
+			assert.Equal(t, tc.expectedAllRemoved, entry.allRemoved)
+
+			// Matching entries on all feeds are consumed by the merge
+			entry = merger.next()
+			require.NotNil(t, entry)
+			assert.Equal(t, "doc2", entry.ID)
+			assert.Nil(t, entry.Removed)
+			assert.Nil(t, merger.next())
+		})
+	}
+}
+
+func TestChangesMergerSkipFailedChannels(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	options := ChangesOptions{Terminator: make(chan bool)}
+	defer close(options.Terminator)
+	newFeeds := func() []<-chan *ChangeEntry {
+		failing := &failingChannelCache{
+			fakeSingleChannelCache: newFakeSingleChannelCache("ABC", &LogEntry{Sequence: 1, DocID: "doc1", RevID: "1-a"}),
+			failures:               1,
+		}
+		healthy := newFakeSingleChannelCache("PBS", &LogEntry{Sequence: 2, DocID: "doc2", RevID: "1-a"}, &LogEntry{Sequence: 3, DocID: "doc3", RevID: "1-a"})
+		return []<-chan *ChangeEntry{db.changesFeed(failing, options, ""), db.changesFeed(healthy, options, "")}
+	}
+
+	// By default, the error is returned
+	merger := newChangesMerger(newFeeds())
+	entry := merger.next()
+	require.NotNil(t, entry)
+	assert.Equal(t, base.ErrChannelFeed, entry.Err)
+
+	// The failed channel is omitted, and the remaining feeds merged
+	merger = newChangesMerger(newFeeds())
+	merger.skipFailedChannels = true
+	var ids []string
+	for entry := merger.next(); entry != nil; entry = merger.next() {
+		require.NoError(t, entry.Err)
+		ids = append(ids, entry.ID)
+	}
+	assert.Equal(t, []string{"doc2", "doc3"}, ids)
+	assert.Equal(t, base.SetOf("ABC"), merger.failedChannels)
+}
+
+func TestChangesFeedWithFakeChannelCache(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	channelCache := NewFakeChannelCache()
+	channelCache.AddEntries("ABC", &LogEntry{Sequence: 1, DocID: "doc1", RevID: "1-a"}, &LogEntry{Sequence: 3, DocID: "doc3", RevID: "1-a"})
+	channelCache.AddEntries("PBS", &LogEntry{Sequence: 2, DocID: "doc2", RevID: "1-a"}, &LogEntry{Sequence: 4, DocID: "doc4", RevID: "1-a"})
+	db.SetChannelCacheForTest(t, channelCache)
+
+	// Entries are merged in sequence order
+	changes, err := db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	for i, change := range changes {
+		assert.Equal(t, uint64(i+1), change.Seq.Seq)
+	}
+
+	// Limit
+	options := getZeroSequence()
+	options.Limit = 3
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), options)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "doc3", changes[2].ID)
+
+	// Entries later than the high cache sequence aren't sent
+	channelCache.SetHighCacheSequence(2)
+	changes, err = db.GetChanges(base.SetOf("ABC", "PBS"), getZeroSequence())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+}
+
+func TestChangesFeedQueryRetry(t *testing.T) {
+
+	db := setupTestDB(t)
+	defer db.Close()
+
+	newCache := func(failures int) *failingChannelCache {
+		return &failingChannelCache{
+			fakeSingleChannelCache: newFakeSingleChannelCache("ABC", &LogEntry{Sequence: 1, DocID: "doc1", RevID: "1-a"}),
+			failures:               failures,
+		}
+	}
+	options := ChangesOptions{Terminator: make(chan bool)}
+	defer close(options.Terminator)
+
+	// Without retries, a failed query terminates the feed with an error
+	feed := db.changesFeed(newCache(1), options, "")
+	entry := <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, base.ErrChannelFeed, entry.Err)
+
+	// Retried queries recover
+	db.Options.ChangesFeedOptions.QueryRetryAttempts = 2
+	db.Options.ChangesFeedOptions.QueryRetryDelay = time.Millisecond
+	feed = db.changesFeed(newCache(2), options, "")
+	entry = <-feed
+	require.NotNil(t, entry)
+	assert.NoError(t, entry.Err)
+	assert.Equal(t, "doc1", entry.ID)
+
+	// Error is returned once retries are exhausted
+	feed = db.changesFeed(newCache(3), options, "")
+	entry = <-feed
+	require.NotNil(t, entry)
+	assert.Equal(t, base.ErrChannelFeed, entry.Err)
+
+	// Termination while waiting to retry closes the feed without an error
+	db.Options.ChangesFeedOptions.QueryRetryDelay = time.Minute
+	terminator := make(chan bool)
+	feed = db.changesFeed(newCache(1), ChangesOptions{Terminator: terminator}, "")
+	close(terminator)
+	_, ok := <-feed
+	assert.False(t, ok)
+}
+
+// Benchmarks the channel feeds and min-sequence merge performed by SimpleMultiChangesFeed, for varying numbers of
+// channels (width) and entries per channel (depth).
+func BenchmarkChangesFeedMerge(b *testing.B) {
+	for _, numChannels := range []int{10, 100, 1000} {
+		for _, entriesPerChannel := range []int{10, 100} {
+			b.Run(fmt.Sprintf("channels=%d/entries=%d", numChannels, entriesPerChannel), func(b *testing.B) {
+				benchmarkChangesFeedMerge(b, numChannels, entriesPerChannel)
+			})
+		}
+	}
+}
+
+func benchmarkChangesFeedMerge(b *testing.B, numChannels, entriesPerChannel int) {
+	defer base.SetUpBenchmarkLogging(base.LevelWarn, base.KeyHTTP)()
+
+	db := &Database{
+		DatabaseContext: &DatabaseContext{
+			Options: DatabaseContextOptions{
+				CacheOptions: &CacheOptions{ChannelQueryLimit: DefaultChannelQueryLimit},
+			},
+		},
+		Ctx: context.Background(),
+	}
+
+	// Sequences are interleaved across channels, so every merged entry requires selection across all feeds
+	caches := make([]SingleChannelCache, numChannels)
+	for c := range caches {
+		cache := newFakeSingleChannelCache(fmt.Sprintf("channel%d", c))
+		for e := 0; e < entriesPerChannel; e++ {
+			seq := uint64(e*numChannels + c + 1)
+			cache.addEntries(&LogEntry{Sequence: seq, DocID: fmt.Sprintf("doc%d", seq), RevID: "1-a"})
+		}
+		caches[c] = cache
+	}
+
+	options := ChangesOptions{Terminator: make(chan bool)}
+	defer close(options.Terminator)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		feeds := make([]<-chan *ChangeEntry, numChannels)
+		for c, cache := range caches {
+			feeds[c] = db.changesFeed(cache, options, "")
+		}
+		merger := newChangesMerger(feeds)
+		for entry := merger.next(); entry != nil; entry = merger.next() {
+		}
+	}
+}
@@ -88,6 +88,7 @@ type SingleChannelCache interface {
 	GetLateSequencesSince(sinceSequence uint64) (entries []*LogEntry, lastSequence uint64, err error)
 	RegisterLateSequenceClient() (latestLateSeq uint64)
 	ReleaseLateSequenceClient(sequence uint64) (success bool)
+	LastLateSequence() uint64
 }
 
 type singleChannelCacheImpl struct {
@@ -760,6 +761,14 @@ func (c *singleChannelCacheImpl) RegisterLateSequenceClient() (latestLateSeq uin
 	return latestLateSeq
 }
 
+// Returns the most recent late-arriving sequence added to the channel cache.  A late sequence client that's already
+// seen this sequence has no new late sequences to process.
+func (c *singleChannelCacheImpl) LastLateSequence() uint64 {
+	c.lateLogLock.RLock()
+	defer c.lateLogLock.RUnlock()
+	return c.lastLateSequence
+}
+
 // Called when a client (a continuous _changes feed) is no longer referencing the sequence number.
 func (c *singleChannelCacheImpl) ReleaseLateSequenceClient(sequence uint64) (success bool) {
 	for _, log := range c.lateLogs {
@@ -861,3 +870,7 @@ func (b *bypassChannelCache) RegisterLateSequenceClient() (latestLateSeq uint64)
 func (b *bypassChannelCache) ReleaseLateSequenceClient(sequence uint64) (success bool) {
 	return false
 }
+
+func (b *bypassChannelCache) LastLateSequence() uint64 {
+	return 0
+}
@@ -82,6 +82,7 @@ type DatabaseContext struct {
 	ImportListener     *importListener          // Import feed listener
 	sequences          *sequenceAllocator       // Source of new sequence numbers
 	ChannelMapper      *channels.ChannelMapper  // Runs JS 'sync' function
+	ChannelNormalizer  func(string) string      // If set, normalizes (e.g. lowercases) channel names when changes feeds match requested channels to the user's channels
 	StartTime          time.Time                // Timestamp when context was instantiated
 	RevsLimit          uint32                   // Max depth a document's revision tree can grow to
 	autoImport         bool                     // Add sync data to new untracked couchbase server docs?  (Xattr mode specific)
@@ -102,32 +103,49 @@ type DatabaseContext struct {
 	activeChannels     *channels.ActiveChannels // Tracks active replications by channel
 	CfgSG              cbgt.Cfg                 // Sync Gateway cluster shared config
 	//CfgSG                        *base.CfgSG              // Sync Gateway cluster shared config
-	SGReplicateMgr               *sgReplicateManager // Manages interactions with sg-replicate replications
-	Heartbeater                  base.Heartbeater    // Node heartbeater for SG cluster awareness
-	ServeInsecureAttachmentTypes bool                // Attachment content type will bypass the content-disposition handling, default false
+	SGReplicateMgr               *sgReplicateManager     // Manages interactions with sg-replicate replications
+	Heartbeater                  base.Heartbeater        // Node heartbeater for SG cluster awareness
+	ServeInsecureAttachmentTypes bool                    // Attachment content type will bypass the content-disposition handling, default false
+	changesFeedSlots             chan struct{}           // Limits the number of concurrently active changes feeds, when ChangesFeedOptions.MaxConcurrentFeeds is set
+	attachmentFetchSlots         chan struct{}           // Limits the number of concurrent attachment fetches for BLIP clients, when MaxConcurrentAttachmentFetches is set
+	changeListeners              *changeListenerRegistry // Tracks currently active changes feeds
 }
 
 type DatabaseContextOptions struct {
-	CacheOptions              *CacheOptions
-	RevisionCacheOptions      *RevisionCacheOptions
-	OldRevExpirySeconds       uint32
-	AdminInterface            *string
-	UnsupportedOptions        UnsupportedOptions
-	OIDCOptions               *auth.OIDCOptions
-	DBOnlineCallback          DBOnlineCallback // Callback function to take the DB back online
-	ImportOptions             ImportOptions
-	EnableXattr               bool             // Use xattr for _sync
-	LocalDocExpirySecs        uint32           // The _local doc expiry time in seconds
-	SecureCookieOverride      bool             // Pass-through DBConfig.SecureCookieOverride
-	SessionCookieName         string           // Pass-through DbConfig.SessionCookieName
-	SessionCookieHttpOnly     bool             // Pass-through DbConfig.SessionCookieHTTPOnly
-	AllowConflicts            *bool            // False forbids creating conflicts
-	SendWWWAuthenticateHeader *bool            // False disables setting of 'WWW-Authenticate' header
-	UseViews                  bool             // Force use of views
-	DeltaSyncOptions          DeltaSyncOptions // Delta Sync Options
-	CompactInterval           uint32           // Interval in seconds between compaction is automatically ran - 0 means don't run
-	SGReplicateOptions        SGReplicateOptions
-	SlowQueryWarningThreshold time.Duration
+	CacheOptions                   *CacheOptions
+	RevisionCacheOptions           *RevisionCacheOptions
+	OldRevExpirySeconds            uint32
+	AdminInterface                 *string
+	UnsupportedOptions             UnsupportedOptions
+	OIDCOptions                    *auth.OIDCOptions
+	DBOnlineCallback               DBOnlineCallback // Callback function to take the DB back online
+	ImportOptions                  ImportOptions
+	EnableXattr                    bool             // Use xattr for _sync
+	LocalDocExpirySecs             uint32           // The _local doc expiry time in seconds
+	SecureCookieOverride           bool             // Pass-through DBConfig.SecureCookieOverride
+	SessionCookieName              string           // Pass-through DbConfig.SessionCookieName
+	SessionCookieHttpOnly          bool             // Pass-through DbConfig.SessionCookieHTTPOnly
+	AllowConflicts                 *bool            // False forbids creating conflicts
+	SendWWWAuthenticateHeader      *bool            // False disables setting of 'WWW-Authenticate' header
+	UseViews                       bool             // Force use of views
+	DeltaSyncOptions               DeltaSyncOptions // Delta Sync Options
+	CompactInterval                uint32           // Interval in seconds between compaction is automatically ran - 0 means don't run
+	SGReplicateOptions             SGReplicateOptions
+	SlowQueryWarningThreshold      time.Duration
+	ChangesFeedOptions             ChangesFeedOptions
+	AttachmentTransferLogSize      int           // Number of the largest pushed attachments recorded with their doc IDs, for debugging - zero disables
+	MaxConcurrentAttachmentFetches int           // Max number of attachments fetched for BLIP clients at once - zero means no limit
+	AttachmentFetchWait            time.Duration // How long an attachment fetch waits for a slot when MaxConcurrentAttachmentFetches has been reached - zero rejects fetches immediately
+}
+
+type ChangesFeedOptions struct {
+	MaxConcurrentFeeds     int                   // Max number of changes feeds that may be active at once - zero means no limit
+	MaxConcurrentFeedsWait time.Duration         // How long a new feed waits for an active feed to finish when MaxConcurrentFeeds has been reached
+	QueryRetryAttempts     int                   // Number of times a failed channel changes query is retried before the feed is terminated
+	QueryRetryDelay        time.Duration         // Delay before the first retry of a failed channel changes query, doubled for each subsequent retry
+	WakeupJitterMax        time.Duration         // Max random delay before a woken continuous feed re-fetches changes - zero means no delay
+	Thresholds             ChangesFeedThresholds // Feed behaviour above which a warning is logged
+	MaxRemovedChannels     int                   // Max number of channels sent in an entry's Removed set, which is truncated beyond this - zero means no limit
 }
 
 type SGReplicateOptions struct {
@@ -245,6 +263,10 @@ func NewDatabaseContext(dbName string, bucket base.Bucket, autoImport bool, opti
 		dbStats.InitDeltaSyncStats()
 	}
 
+	if options.AttachmentTransferLogSize > 0 {
+		dbStats.InitAttachmentTransferLog(options.AttachmentTransferLogSize)
+	}
+
 	if autoImport || options.EnableXattr {
 		dbStats.InitSharedBucketImportStats()
 	}
@@ -295,6 +317,16 @@ func NewDatabaseContext(dbName string, bucket base.Bucket, autoImport bool, opti
 
 	dbContext.terminator = make(chan bool)
 
+	if maxFeeds := options.ChangesFeedOptions.MaxConcurrentFeeds; maxFeeds > 0 {
+		dbContext.changesFeedSlots = make(chan struct{}, maxFeeds)
+		dbStats.ChangesFeed().MaxConcurrentFeeds.Set(int64(maxFeeds))
+	}
+
+	if maxFetches := options.MaxConcurrentAttachmentFetches; maxFetches > 0 {
+		dbContext.attachmentFetchSlots = make(chan struct{}, maxFetches)
+		dbStats.CBLReplicationPull().AttachmentPullMaxConcurrent.Set(int64(maxFetches))
+	}
+
 	dbContext.revisionCache = NewRevisionCache(
 		dbContext.Options.RevisionCacheOptions,
 		dbContext,
@@ -327,6 +359,9 @@ func NewDatabaseContext(dbName string, bucket base.Bucket, autoImport bool, opti
 	// Initialize the active channel counter
 	dbContext.activeChannels = channels.NewActiveChannels(dbStats.Cache().NumActiveChannels)
 
+	// Initialize the registry of active changes feeds
+	dbContext.changeListeners = newChangeListenerRegistry()
+
 	// Initialize the ChangeCache.  Will be locked and unusable until .Start() is called (SG #3558)
 	err = dbContext.changeCache.Init(
 		dbContext,
@@ -510,6 +545,12 @@ func NewDatabaseContext(dbName string, bucket base.Bucket, autoImport bool, opti
 		}
 	}
 
+	// Started once nothing else can fail, as nothing closes the terminator if NewDatabaseContext returns an error
+	err = NewBackgroundTask("AttachmentRates", dbContext.Name, BlipSyncStatsForCBL(dbStats).updateAttachmentRates, attachmentRateUpdateInterval, dbContext.terminator)
+	if err != nil {
+		return nil, err
+	}
+
 	dbContext.ExitChanges = make(chan struct{})
 
 	return dbContext, nil
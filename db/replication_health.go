@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ReplicationHealthStatus summarises replication health as a single value, exposed as a gauge.
+type ReplicationHealthStatus int
+
+const (
+	ReplicationHealthOK ReplicationHealthStatus = iota
+	ReplicationHealthDegraded
+	ReplicationHealthFailing
+)
+
+func (s ReplicationHealthStatus) String() string {
+	switch s {
+	case ReplicationHealthOK:
+		return "ok"
+	case ReplicationHealthDegraded:
+		return "degraded"
+	case ReplicationHealthFailing:
+		return "failing"
+	default:
+		return "unknown"
+	}
+}
+
+// Interval at which replication health is rederived from the replication's stats
+var DefaultReplicationHealthInterval = 10 * time.Second
+
+// Thresholds for the ratios of errors and conflicts to revisions sent or handled (including failures) during an
+// interval.  Configurable per replication (see ReplicationConfig.HealthThresholds).
+type ReplicationHealthThresholds struct {
+	DegradedErrorRatio    float64 `json:"degraded_error_ratio,omitempty"`    // Error ratio at or above which replication is degraded
+	FailingErrorRatio     float64 `json:"failing_error_ratio,omitempty"`     // Error ratio at or above which replication is failing
+	DegradedConflictRatio float64 `json:"degraded_conflict_ratio,omitempty"` // Conflict ratio at or above which replication is degraded
+}
+
+var DefaultReplicationHealthThresholds = ReplicationHealthThresholds{
+	DegradedErrorRatio:    0.05,
+	FailingErrorRatio:     0.5,
+	DegradedConflictRatio: 0.02,
+}
+
+// Returns the thresholds with unset (zero) thresholds replaced by their defaults.
+func (t ReplicationHealthThresholds) withDefaults() ReplicationHealthThresholds {
+	if t.DegradedErrorRatio == 0 {
+		t.DegradedErrorRatio = DefaultReplicationHealthThresholds.DegradedErrorRatio
+	}
+	if t.FailingErrorRatio == 0 {
+		t.FailingErrorRatio = DefaultReplicationHealthThresholds.FailingErrorRatio
+	}
+	if t.DegradedConflictRatio == 0 {
+		t.DegradedConflictRatio = DefaultReplicationHealthThresholds.DegradedConflictRatio
+	}
+	return t
+}
+
+// Returns an error if any threshold is outside the range 0-1, or if the failing error ratio (with defaults applied) is
+// below the degraded error ratio, which would make the degraded status unreachable.
+func (t ReplicationHealthThresholds) validate() error {
+	for _, ratio := range []float64{t.DegradedErrorRatio, t.FailingErrorRatio, t.DegradedConflictRatio} {
+		if ratio < 0 || ratio > 1 {
+			return base.HTTPErrorf(http.StatusBadRequest, "Replication health_thresholds must be between 0 and 1")
+		}
+	}
+	if withDefaults := t.withDefaults(); withDefaults.FailingErrorRatio < withDefaults.DegradedErrorRatio {
+		return base.HTTPErrorf(http.StatusBadRequest, "Replication health_thresholds failing_error_ratio must not be below degraded_error_ratio")
+	}
+	return nil
+}
+
+// ReplicationHealth is derived from the change in a replication's BlipSyncStats over an interval.
+type ReplicationHealth struct {
+	ErrorRatio    float64                 `json:"error_ratio"`    // (SendRevErrorTotal + HandleRevErrorCount) / revisions sent or handled
+	ConflictRatio float64                 `json:"conflict_ratio"` // SendRevErrorConflictCount / revisions sent or handled
+	Progressing   bool                    `json:"progressing"`    // Whether any revisions were successfully sent or handled
+	Status        ReplicationHealthStatus `json:"status"`
+}
+
+// Snapshot of the BlipSyncStats counters that replication health is derived from.
+type ReplicationHealthCounters struct {
+	SendRevCount              int64
+	SendRevErrorTotal         int64
+	SendRevErrorConflictCount int64
+	HandleRevCount            int64
+	HandleRevErrorCount       int64
+}
+
+func (s *BlipSyncStats) HealthCounters() ReplicationHealthCounters {
+	return ReplicationHealthCounters{
+		SendRevCount:              s.SendRevCount.Value(),
+		SendRevErrorTotal:         s.SendRevErrorTotal.Value(),
+		SendRevErrorConflictCount: s.SendRevErrorConflictCount.Value(),
+		HandleRevCount:            s.HandleRevCount.Value(),
+		HandleRevErrorCount:       s.HandleRevErrorCount.Value(),
+	}
+}
+
+// Derives replication health from the counters accumulated between previous and current.  Replication is failing
+// when the error ratio reaches FailingErrorRatio, or when revisions are failing without any progress being made.
+func (t ReplicationHealthThresholds) Evaluate(previous, current ReplicationHealthCounters) ReplicationHealth {
+	sent := counterDelta(previous.SendRevCount, current.SendRevCount)
+	errors := counterDelta(previous.SendRevErrorTotal, current.SendRevErrorTotal) + counterDelta(previous.HandleRevErrorCount, current.HandleRevErrorCount)
+	conflicts := counterDelta(previous.SendRevErrorConflictCount, current.SendRevErrorConflictCount)
+	handled := counterDelta(previous.HandleRevCount, current.HandleRevCount)
+
+	health := ReplicationHealth{
+		Progressing: sent > 0 || handled > 0,
+	}
+	if attempted := sent + handled + errors; attempted > 0 {
+		health.ErrorRatio = float64(errors) / float64(attempted)
+		health.ConflictRatio = float64(conflicts) / float64(attempted)
+	}
+
+	switch {
+	case health.ErrorRatio >= t.FailingErrorRatio || (errors > 0 && !health.Progressing):
+		health.Status = ReplicationHealthFailing
+	case health.ErrorRatio >= t.DegradedErrorRatio || health.ConflictRatio >= t.DegradedConflictRatio:
+		health.Status = ReplicationHealthDegraded
+	default:
+		health.Status = ReplicationHealthOK
+	}
+	return health
+}
+
+// Returns the increase in a counter between two samples.  A counter that has been reset since the previous sample
+// is treated as having started from zero.
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// Sets gauge to the replication's health every interval, until ctx is done.
+func monitorReplicationHealth(ctx context.Context, stats *BlipSyncStats, thresholds ReplicationHealthThresholds, interval time.Duration, gauge *base.SgwIntStat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := stats.HealthCounters()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := stats.HealthCounters()
+			health := thresholds.Evaluate(previous, current)
+			gauge.Set(int64(health.Status))
+			if health.Status != ReplicationHealthOK {
+				base.DebugfCtx(ctx, base.KeyReplicate, "Replication health %s: %+v", health.Status, health)
+			}
+			previous = current
+		}
+	}
+}
+
+// Starts monitoring the replication's health (sgr_replication_health), until ctx is done.  A bidirectional
+// replication's health covers both directions, so is only monitored by its push replicator.
+func (a *activeReplicatorCommon) startHealthMonitor(ctx context.Context, direction ActiveReplicatorDirection) {
+	statsMap := a.config.ReplicationStatsMap
+	if statsMap == nil {
+		return
+	}
+	stats := a.replicationStats
+	if a.config.Direction == ActiveReplicatorTypePushAndPull {
+		if direction != ActiveReplicatorTypePush {
+			return
+		}
+		stats = BlipSyncStatsForSGRBidirectional(statsMap)
+	}
+	go monitorReplicationHealth(ctx, stats, a.config.HealthThresholds.withDefaults(), DefaultReplicationHealthInterval, statsMap.ReplicationHealth)
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationHealthEvaluate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		current       ReplicationHealthCounters
+		expected      ReplicationHealthStatus
+		expectedRatio float64
+	}{
+		{name: "idle", current: ReplicationHealthCounters{}, expected: ReplicationHealthOK},
+		{name: "healthy", current: ReplicationHealthCounters{SendRevCount: 100}, expected: ReplicationHealthOK},
+		{name: "degraded errors", current: ReplicationHealthCounters{SendRevCount: 90, SendRevErrorTotal: 10}, expected: ReplicationHealthDegraded, expectedRatio: 0.1},
+		{name: "degraded conflicts", current: ReplicationHealthCounters{SendRevCount: 98, SendRevErrorTotal: 2, SendRevErrorConflictCount: 2}, expected: ReplicationHealthDegraded, expectedRatio: 0.02},
+		{name: "failing errors", current: ReplicationHealthCounters{SendRevCount: 40, SendRevErrorTotal: 60}, expected: ReplicationHealthFailing, expectedRatio: 0.6},
+		{name: "failing without progress", current: ReplicationHealthCounters{SendRevErrorTotal: 1}, expected: ReplicationHealthFailing, expectedRatio: 1},
+		{name: "healthy pull", current: ReplicationHealthCounters{HandleRevCount: 100}, expected: ReplicationHealthOK},
+		{name: "degraded pull errors", current: ReplicationHealthCounters{HandleRevCount: 90, HandleRevErrorCount: 10}, expected: ReplicationHealthDegraded, expectedRatio: 0.1},
+	}
+
+	previous := ReplicationHealthCounters{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			health := DefaultReplicationHealthThresholds.Evaluate(previous, tc.current)
+			assert.Equal(t, tc.expected, health.Status)
+			assert.InDelta(t, tc.expectedRatio, health.ErrorRatio, 0.0001)
+		})
+	}
+
+	// A reset counter is treated as starting from zero
+	health := DefaultReplicationHealthThresholds.Evaluate(ReplicationHealthCounters{SendRevCount: 50, SendRevErrorTotal: 50}, ReplicationHealthCounters{SendRevCount: 10})
+	assert.Equal(t, ReplicationHealthOK, health.Status)
+	assert.True(t, health.Progressing)
+}
+
+func TestReplicationHealthThresholds(t *testing.T) {
+	// Unset thresholds use their defaults
+	thresholds := ReplicationHealthThresholds{FailingErrorRatio: 0.2}.withDefaults()
+	assert.Equal(t, ReplicationHealthThresholds{
+		DegradedErrorRatio:    DefaultReplicationHealthThresholds.DegradedErrorRatio,
+		FailingErrorRatio:     0.2,
+		DegradedConflictRatio: DefaultReplicationHealthThresholds.DegradedConflictRatio,
+	}, thresholds)
+	health := thresholds.Evaluate(ReplicationHealthCounters{}, ReplicationHealthCounters{SendRevCount: 70, SendRevErrorTotal: 30})
+	assert.Equal(t, ReplicationHealthFailing, health.Status)
+
+	// Thresholds set through the replication config are validated
+	replicationConfig := &ReplicationConfig{ID: "rep1", Remote: "http://remote:4984/db", Direction: ActiveReplicatorTypePull}
+	replicationConfig.Upsert(&ReplicationUpsertConfig{HealthThresholds: &ReplicationHealthThresholds{FailingErrorRatio: 1.5}})
+	assert.Error(t, replicationConfig.ValidateReplication(false))
+	// Including against the defaults of unset thresholds
+	replicationConfig.Upsert(&ReplicationUpsertConfig{HealthThresholds: &ReplicationHealthThresholds{FailingErrorRatio: 0.01}})
+	assert.Error(t, replicationConfig.ValidateReplication(false))
+	replicationConfig.Upsert(&ReplicationUpsertConfig{HealthThresholds: &ReplicationHealthThresholds{DegradedErrorRatio: 0.6}})
+	assert.Error(t, replicationConfig.ValidateReplication(false))
+	replicationConfig.Upsert(&ReplicationUpsertConfig{HealthThresholds: &ReplicationHealthThresholds{FailingErrorRatio: 0.2}})
+	assert.NoError(t, replicationConfig.ValidateReplication(false))
+	assert.Equal(t, 0.2, replicationConfig.HealthThresholds.FailingErrorRatio)
+}
@@ -208,6 +208,7 @@ type RevisionDelta struct {
 	ToChannels        base.Set // Full list of channels for the to revision
 	RevisionHistory   []string // Revision history from parent of ToRevID to source revID, in descending order
 	ToDeleted         bool     // Flag if ToRevID is a tombstone
+	ToBodySize        int      // Size of ToRevID's full body, for comparison against the size of the delta
 }
 
 func newRevCacheDelta(deltaBytes []byte, fromRevID string, toRevision DocumentRevision, deleted bool) RevisionDelta {
@@ -218,6 +219,7 @@ func newRevCacheDelta(deltaBytes []byte, fromRevID string, toRevision DocumentRe
 		ToChannels:        toRevision.Channels,
 		RevisionHistory:   toRevision.History.parseAncestorRevisions(fromRevID),
 		ToDeleted:         deleted,
+		ToBodySize:        len(toRevision.BodyBytes),
 	}
 }
 
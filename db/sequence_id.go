@@ -60,6 +60,36 @@ func (dbc *DatabaseContext) ParseSequenceID(str string) (s SequenceID, err error
 	return parseIntegerSequenceID(str)
 }
 
+// ParseSince parses a since value as sent by a client - an integer sequence, or a composite sequence in any of the
+// formats produced by SequenceID.String.  The JSON forms produced by SequenceID.MarshalJSON (a number, or a quoted
+// composite) are also accepted.  Clock hash sequences aren't supported for integer sequences and are rejected, as is a
+// zero TriggeredBy in the TriggeredBy:Seq form, which SequenceID.String never produces and is ambiguous with LowSeq::Seq.
+// Errors are 400 HTTPErrors describing why the value was rejected.
+func ParseSince(raw string) (SequenceID, error) {
+	str := strings.TrimSpace(raw)
+	if strings.HasPrefix(str, `"`) {
+		if err := base.JSONUnmarshal([]byte(str), &str); err != nil {
+			return SequenceID{}, base.HTTPErrorf(400, "Invalid since %q: malformed JSON string", raw)
+		}
+	}
+	for _, c := range str {
+		if (c < '0' || c > '9') && c != ':' {
+			return SequenceID{}, base.HTTPErrorf(400, "Invalid since %q: expected an integer sequence, or colon-separated integer components (clock hash sequences aren't supported)", raw)
+		}
+	}
+	if strings.Count(str, ":") > 2 {
+		return SequenceID{}, base.HTTPErrorf(400, "Invalid since %q: too many components", raw)
+	}
+	s, err := parseIntegerSequenceID(str)
+	if err != nil {
+		return SequenceID{}, base.HTTPErrorf(400, "Invalid since %q: components must be non-empty integers", raw)
+	}
+	if strings.Count(str, ":") == 1 && s.TriggeredBy == 0 {
+		return SequenceID{}, base.HTTPErrorf(400, "Invalid since %q: a zero TriggeredBy is ambiguous", raw)
+	}
+	return s, nil
+}
+
 func parseIntegerSequenceID(str string) (s SequenceID, err error) {
 	if str == "" {
 		return SequenceID{}, nil
@@ -174,3 +204,17 @@ func (s SequenceID) intBefore(s2 SequenceID) bool {
 		return s.TriggeredBy < s2.TriggeredBy // both triggered, but by different sequences
 	}
 }
+
+// Returns the earliest of the given sequences (per Before), or the zero sequence when none are given.
+func MinSequenceID(seqs ...SequenceID) SequenceID {
+	if len(seqs) == 0 {
+		return SequenceID{}
+	}
+	min := seqs[0]
+	for _, seq := range seqs[1:] {
+		if seq.Before(min) {
+			min = seq
+		}
+	}
+	return min
+}
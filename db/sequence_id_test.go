@@ -6,6 +6,7 @@ import (
 	"github.com/couchbase/sync_gateway/base"
 	goassert "github.com/couchbaselabs/go.assert"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseSequenceID(t *testing.T) {
@@ -43,6 +44,42 @@ func TestParseSequenceID(t *testing.T) {
 	goassert.True(t, err != nil)
 }
 
+func TestParseSince(t *testing.T) {
+	testCases := []struct {
+		raw      string
+		expected SequenceID
+	}{
+		{"", SequenceID{}},
+		{"1234", SequenceID{Seq: 1234}},
+		{" 1234 ", SequenceID{Seq: 1234}},
+		{"5678:1234", SequenceID{TriggeredBy: 5678, Seq: 1234}},
+		{"123::789", SequenceID{LowSeq: 123, Seq: 789}},
+		{"123:456:789", SequenceID{LowSeq: 123, TriggeredBy: 456, Seq: 789}},
+		{`"5678:1234"`, SequenceID{TriggeredBy: 5678, Seq: 1234}},
+	}
+	for _, tc := range testCases {
+		s, err := ParseSince(tc.raw)
+		assert.NoError(t, err, "ParseSince(%q)", tc.raw)
+		assert.Equal(t, tc.expected, s, "ParseSince(%q)", tc.raw)
+	}
+
+	// Values produced by MarshalJSON round-trip
+	for _, seq := range []SequenceID{{Seq: 1234}, {TriggeredBy: 5678, Seq: 1234}, {LowSeq: 123, TriggeredBy: 456, Seq: 789}} {
+		asJSON, err := base.JSONMarshal(seq)
+		require.NoError(t, err)
+		s, err := ParseSince(string(asJSON))
+		assert.NoError(t, err)
+		assert.Equal(t, seq, s)
+	}
+
+	for _, raw := range []string{"foo", "abc-123", "-1", ":", ":1", "5:", "::1", "0:5", "10:11:12:13", `"123`} {
+		_, err := ParseSince(raw)
+		if assert.Error(t, err, "ParseSince(%q)", raw) {
+			assert.Contains(t, err.Error(), "Invalid since")
+		}
+	}
+}
+
 func TestMarshalSequenceID(t *testing.T) {
 	s := SequenceID{Seq: 1234}
 	goassert.Equals(t, s.String(), "1234")
@@ -108,6 +145,32 @@ func TestMarshalTriggeredSequenceID(t *testing.T) {
 	goassert.Equals(t, s2, s)
 }
 
+// Ensures the composite (low seq and triggered by) forms survive a marshal/unmarshal round trip, so that clients
+// echoing back a sequence as Since resume an in-progress backfill at the same position.
+func TestSequenceIDRoundTrip(t *testing.T) {
+	testCases := []struct {
+		seq          SequenceID
+		expectedJSON string
+	}{
+		{SequenceID{Seq: 1234}, "1234"},
+		{SequenceID{TriggeredBy: 5678, Seq: 1234}, "\"5678:1234\""},
+		{SequenceID{LowSeq: 1000, Seq: 1234}, "\"1000::1234\""},
+		{SequenceID{LowSeq: 1000, TriggeredBy: 5678, Seq: 1234}, "\"1000:5678:1234\""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.seq.String(), func(t *testing.T) {
+			asJSON, err := base.JSONMarshal(testCase.seq)
+			assert.NoError(t, err, "Marshal failed")
+			assert.Equal(t, testCase.expectedJSON, string(asJSON))
+
+			var roundTripped SequenceID
+			assert.NoError(t, base.JSONUnmarshal(asJSON, &roundTripped), "Unmarshal failed")
+			assert.Equal(t, testCase.seq, roundTripped)
+		})
+	}
+}
+
 func TestCompareSequenceIDs(t *testing.T) {
 	orderedSeqs := []SequenceID{
 		{Seq: 1234},
@@ -125,3 +188,19 @@ func TestCompareSequenceIDs(t *testing.T) {
 		}
 	}
 }
+
+func TestMinSequenceID(t *testing.T) {
+	assert.Equal(t, SequenceID{}, MinSequenceID())
+	assert.Equal(t, SequenceID{Seq: 5}, MinSequenceID(SequenceID{Seq: 5}))
+
+	// Divergent checkpoints, including a backfill sequence that sorts before its triggering sequence
+	sinces := []SequenceID{
+		{Seq: 20},
+		{Seq: 12, TriggeredBy: 15},
+		{Seq: 18, LowSeq: 16},
+	}
+	assert.Equal(t, SequenceID{Seq: 12, TriggeredBy: 15}, MinSequenceID(sinces...))
+
+	sinces = append(sinces, SequenceID{Seq: 14})
+	assert.Equal(t, SequenceID{Seq: 14}, MinSequenceID(sinces...))
+}
@@ -79,23 +79,24 @@ func NewSGNode(uuid string, host string) *SGNode {
 
 // ReplicationConfig is a replication definition as stored in the Sync Gateway config
 type ReplicationConfig struct {
-	ID                     string                    `json:"replication_id"`
-	Remote                 string                    `json:"remote"`
-	Username               string                    `json:"username,omitempty"`
-	Password               string                    `json:"password,omitempty"`
-	Direction              ActiveReplicatorDirection `json:"direction"`
-	ConflictResolutionType ConflictResolverType      `json:"conflict_resolution_type,omitempty"`
-	ConflictResolutionFn   string                    `json:"custom_conflict_resolver,omitempty"`
-	PurgeOnRemoval         bool                      `json:"purge_on_removal,omitempty"`
-	DeltaSyncEnabled       bool                      `json:"enable_delta_sync,omitempty"`
-	MaxBackoff             int                       `json:"max_backoff_time,omitempty"`
-	InitialState           string                    `json:"initial_state,omitempty"`
-	Continuous             bool                      `json:"continuous"`
-	Filter                 string                    `json:"filter,omitempty"`
-	QueryParams            interface{}               `json:"query_params,omitempty"`
-	Cancel                 bool                      `json:"cancel,omitempty"`
-	Adhoc                  bool                      `json:"adhoc,omitempty"`
-	BatchSize              int                       `json:"batch_size,omitempty"`
+	ID                     string                       `json:"replication_id"`
+	Remote                 string                       `json:"remote"`
+	Username               string                       `json:"username,omitempty"`
+	Password               string                       `json:"password,omitempty"`
+	Direction              ActiveReplicatorDirection    `json:"direction"`
+	ConflictResolutionType ConflictResolverType         `json:"conflict_resolution_type,omitempty"`
+	ConflictResolutionFn   string                       `json:"custom_conflict_resolver,omitempty"`
+	PurgeOnRemoval         bool                         `json:"purge_on_removal,omitempty"`
+	DeltaSyncEnabled       bool                         `json:"enable_delta_sync,omitempty"`
+	MaxBackoff             int                          `json:"max_backoff_time,omitempty"`
+	InitialState           string                       `json:"initial_state,omitempty"`
+	Continuous             bool                         `json:"continuous"`
+	Filter                 string                       `json:"filter,omitempty"`
+	QueryParams            interface{}                  `json:"query_params,omitempty"`
+	Cancel                 bool                         `json:"cancel,omitempty"`
+	Adhoc                  bool                         `json:"adhoc,omitempty"`
+	BatchSize              int                          `json:"batch_size,omitempty"`
+	HealthThresholds       *ReplicationHealthThresholds `json:"health_thresholds,omitempty"`
 }
 
 func DefaultReplicationConfig() ReplicationConfig {
@@ -121,24 +122,25 @@ type ReplicationCfg struct {
 
 // ReplicationUpsertConfig is used for operations that support upsert of a subset of replication properties.
 type ReplicationUpsertConfig struct {
-	ID                     string      `json:"replication_id"`
-	Remote                 *string     `json:"remote"`
-	Username               *string     `json:"username,omitempty"`
-	Password               *string     `json:"password,omitempty"`
-	Direction              *string     `json:"direction"`
-	ConflictResolutionType *string     `json:"conflict_resolution_type,omitempty"`
-	ConflictResolutionFn   *string     `json:"custom_conflict_resolver,omitempty"`
-	PurgeOnRemoval         *bool       `json:"purge_on_removal,omitempty"`
-	DeltaSyncEnabled       *bool       `json:"enable_delta_sync,omitempty"`
-	MaxBackoff             *int        `json:"max_backoff_time,omitempty"`
-	InitialState           *string     `json:"initial_state,omitempty"`
-	Continuous             *bool       `json:"continuous"`
-	Filter                 *string     `json:"filter,omitempty"`
-	QueryParams            interface{} `json:"query_params,omitempty"`
-	Cancel                 *bool       `json:"cancel,omitempty"`
-	Adhoc                  *bool       `json:"adhoc,omitempty"`
-	BatchSize              *int        `json:"batch_size,omitempty"`
-	SGR1CheckpointID       *string     `json:"sgr1_checkpoint_id,omitempty"`
+	ID                     string                       `json:"replication_id"`
+	Remote                 *string                      `json:"remote"`
+	Username               *string                      `json:"username,omitempty"`
+	Password               *string                      `json:"password,omitempty"`
+	Direction              *string                      `json:"direction"`
+	ConflictResolutionType *string                      `json:"conflict_resolution_type,omitempty"`
+	ConflictResolutionFn   *string                      `json:"custom_conflict_resolver,omitempty"`
+	PurgeOnRemoval         *bool                        `json:"purge_on_removal,omitempty"`
+	DeltaSyncEnabled       *bool                        `json:"enable_delta_sync,omitempty"`
+	MaxBackoff             *int                         `json:"max_backoff_time,omitempty"`
+	InitialState           *string                      `json:"initial_state,omitempty"`
+	Continuous             *bool                        `json:"continuous"`
+	Filter                 *string                      `json:"filter,omitempty"`
+	QueryParams            interface{}                  `json:"query_params,omitempty"`
+	Cancel                 *bool                        `json:"cancel,omitempty"`
+	Adhoc                  *bool                        `json:"adhoc,omitempty"`
+	BatchSize              *int                         `json:"batch_size,omitempty"`
+	SGR1CheckpointID       *string                      `json:"sgr1_checkpoint_id,omitempty"`
+	HealthThresholds       *ReplicationHealthThresholds `json:"health_thresholds,omitempty"`
 }
 
 func (rc *ReplicationConfig) ValidateReplication(fromConfig bool) (err error) {
@@ -225,6 +227,12 @@ func (rc *ReplicationConfig) ValidateReplication(fromConfig bool) (err error) {
 	} else if rc.Filter != "" {
 		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorUnknownFilter)
 	}
+
+	if rc.HealthThresholds != nil {
+		if err := rc.HealthThresholds.validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -287,6 +295,11 @@ func (rc *ReplicationConfig) Upsert(c *ReplicationUpsertConfig) {
 		rc.BatchSize = *c.BatchSize
 	}
 
+	if c.HealthThresholds != nil {
+		thresholds := *c.HealthThresholds
+		rc.HealthThresholds = &thresholds
+	}
+
 	if c.QueryParams != nil {
 		// QueryParams can be either []interface{} or map[string]interface{}, so requires type-specific copying
 		// avoid later mutating c.QueryParams
@@ -493,6 +506,10 @@ func (m *sgReplicateManager) NewActiveReplicatorConfig(config *ReplicationCfg) (
 		rc.ChangesBatchSize = uint16(config.BatchSize)
 	}
 
+	if config.HealthThresholds != nil {
+		rc.HealthThresholds = *config.HealthThresholds
+	}
+
 	// Channel filter processing
 	if config.Filter == base.ByChannelFilter {
 		rc.Filter = base.ByChannelFilter
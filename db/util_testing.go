@@ -6,11 +6,15 @@ import (
 	"expvar"
 	"fmt"
 	"math"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/couchbase/gocb"
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -325,3 +329,208 @@ func SuspendSequenceBatching() func() {
 	MaxSequenceIncrFrequency = 0 * time.Millisecond
 	return func() { MaxSequenceIncrFrequency = oldFrequency }
 }
+
+// FakeChannelCache is an in-memory ChannelCache serving pre-seeded entries for each channel, for deterministic
+// testing of changes feed processing (backfill, merge ordering, limits) without relying on DCP or channel queries.
+// Install with DatabaseContext.SetChannelCacheForTest.
+type FakeChannelCache struct {
+	lock         sync.RWMutex
+	channels     map[string]*fakeSingleChannelCache
+	highCacheSeq uint64
+}
+
+var _ ChannelCache = &FakeChannelCache{}
+
+func NewFakeChannelCache() *FakeChannelCache {
+	return &FakeChannelCache{
+		channels: make(map[string]*fakeSingleChannelCache),
+	}
+}
+
+// Replaces the database's channel cache for the remainder of the test.  Should be called before any changes feeds
+// are started.
+func (db *DatabaseContext) SetChannelCacheForTest(tb testing.TB, channelCache ChannelCache) {
+	tb.Helper()
+	db.changeCache.lock.Lock()
+	db.changeCache.channelCache = channelCache
+	db.changeCache.lock.Unlock()
+}
+
+// AddEntries adds entries to the given channel, and advances the high cache sequence to include them.
+func (c *FakeChannelCache) AddEntries(channelName string, entries ...*LogEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c._getSingleChannelCache(channelName).addEntries(entries...)
+	for _, entry := range entries {
+		if entry.Sequence > c.highCacheSeq {
+			c.highCacheSeq = entry.Sequence
+		}
+	}
+}
+
+// SetHighCacheSequence sets the high cache sequence.  Entries later than the high cache sequence aren't sent by
+// changes feeds.
+func (c *FakeChannelCache) SetHighCacheSequence(sequence uint64) {
+	c.lock.Lock()
+	c.highCacheSeq = sequence
+	c.lock.Unlock()
+}
+
+func (c *FakeChannelCache) Init(initialSequence uint64) {
+	c.SetHighCacheSequence(initialSequence)
+}
+
+// Adds the change to each of its channels and the star channel.  Removals aren't cached.
+func (c *FakeChannelCache) AddToCache(change *LogEntry) []string {
+	channelNames := []string{channels.UserStarChannel}
+	for channelName, removal := range change.Channels {
+		if removal == nil && channelName != channels.UserStarChannel {
+			channelNames = append(channelNames, channelName)
+		}
+	}
+	for _, channelName := range channelNames {
+		c.AddEntries(channelName, change)
+	}
+	return channelNames
+}
+
+func (c *FakeChannelCache) AddPrincipal(change *LogEntry) {
+	c.lock.Lock()
+	if change.Sequence > c.highCacheSeq {
+		c.highCacheSeq = change.Sequence
+	}
+	c.lock.Unlock()
+}
+
+func (c *FakeChannelCache) Remove(docIDs []string, startTime time.Time) (count int) {
+	return 0
+}
+
+func (c *FakeChannelCache) GetChanges(channelName string, options ChangesOptions) ([]*LogEntry, error) {
+	return c.getSingleChannelCache(channelName).GetChanges(options)
+}
+
+func (c *FakeChannelCache) GetCachedChanges(channelName string) []*LogEntry {
+	_, entries := c.getSingleChannelCache(channelName).GetCachedChanges(ChangesOptions{})
+	return entries
+}
+
+func (c *FakeChannelCache) Clear() {
+	c.lock.Lock()
+	c.channels = make(map[string]*fakeSingleChannelCache)
+	c.lock.Unlock()
+}
+
+func (c *FakeChannelCache) MaxCacheSize() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	maxSize := 0
+	for _, cache := range c.channels {
+		if size := cache.size(); size > maxSize {
+			maxSize = size
+		}
+	}
+	return maxSize
+}
+
+func (c *FakeChannelCache) GetHighCacheSequence() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.highCacheSeq
+}
+
+func (c *FakeChannelCache) getSingleChannelCache(channelName string) SingleChannelCache {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c._getSingleChannelCache(channelName)
+}
+
+// Returns the cache for the channel, creating an empty cache if needed.  Requires c.lock.
+func (c *FakeChannelCache) _getSingleChannelCache(channelName string) *fakeSingleChannelCache {
+	cache, ok := c.channels[channelName]
+	if !ok {
+		cache = newFakeSingleChannelCache(channelName)
+		c.channels[channelName] = cache
+	}
+	return cache
+}
+
+// In-memory SingleChannelCache serving a sequence-ordered set of entries.  Doesn't support late sequence feeds.
+type fakeSingleChannelCache struct {
+	channelName string
+	lock        sync.RWMutex
+	entries     []*LogEntry
+}
+
+var _ SingleChannelCache = &fakeSingleChannelCache{}
+
+func newFakeSingleChannelCache(channelName string, entries ...*LogEntry) *fakeSingleChannelCache {
+	cache := &fakeSingleChannelCache{channelName: channelName}
+	cache.addEntries(entries...)
+	return cache
+}
+
+// Adds entries to the cache, maintaining sequence order.
+func (c *fakeSingleChannelCache) addEntries(entries ...*LogEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = append(c.entries, entries...)
+	sort.SliceStable(c.entries, func(i, j int) bool {
+		return c.entries[i].Sequence < c.entries[j].Sequence
+	})
+}
+
+func (c *fakeSingleChannelCache) size() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.entries)
+}
+
+func (c *fakeSingleChannelCache) GetChanges(options ChangesOptions) ([]*LogEntry, error) {
+	_, result := c.GetCachedChanges(options)
+	return result, nil
+}
+
+func (c *fakeSingleChannelCache) GetCachedChanges(options ChangesOptions) (validFrom uint64, result []*LogEntry) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	start := sort.Search(len(c.entries), func(i int) bool {
+		return c.entries[i].Sequence > options.Since.Seq
+	})
+	end := len(c.entries)
+	if options.Limit > 0 && end-start > options.Limit {
+		end = start + options.Limit
+	}
+	// Copied, as addEntries reorders c.entries in place
+	result = make([]*LogEntry, end-start)
+	copy(result, c.entries[start:end])
+	return 0, result
+}
+
+func (c *fakeSingleChannelCache) ChannelName() string {
+	return c.channelName
+}
+
+func (c *fakeSingleChannelCache) SupportsLateFeed() bool {
+	return false
+}
+
+func (c *fakeSingleChannelCache) LateSequenceUUID() uuid.UUID {
+	return uuid.UUID{}
+}
+
+func (c *fakeSingleChannelCache) GetLateSequencesSince(sinceSequence uint64) (entries []*LogEntry, lastSequence uint64, err error) {
+	return nil, 0, nil
+}
+
+func (c *fakeSingleChannelCache) RegisterLateSequenceClient() (latestLateSeq uint64) {
+	return 0
+}
+
+func (c *fakeSingleChannelCache) ReleaseLateSequenceClient(sequence uint64) (success bool) {
+	return true
+}
+
+func (c *fakeSingleChannelCache) LastLateSequence() uint64 {
+	return 0
+}
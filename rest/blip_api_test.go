@@ -2651,6 +2651,81 @@ func TestBlipNonDeltaSyncPush(t *testing.T) {
 	assert.Contains(t, resp.Body.String(), `{"howdy":"bob"}`)
 }
 
+// TestBlipDeltaSyncUncompressedBytes tests that the uncompressed byte stats count deltas at their full body size, and
+// full body revisions at their wire size.
+func TestBlipDeltaSyncUncompressedBytes(t *testing.T) {
+
+	defer base.SetUpTestLogging(base.LevelInfo, base.KeyAll)()
+	sgUseDeltas := base.IsEnterpriseEdition()
+	rtConfig := RestTesterConfig{
+		DatabaseConfig: &DbConfig{
+			DeltaSync: &DeltaSyncConfig{
+				Enabled: &sgUseDeltas,
+			},
+		},
+		guestEnabled: true,
+	}
+	rt := NewRestTester(t, &rtConfig)
+	defer rt.Close()
+
+	dbStats := rt.GetDatabase().DbStats.Database()
+
+	client, err := NewBlipTesterClientOptsWithRT(t, rt, nil)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	client.ClientDeltas = true
+	err = client.StartPull()
+	assert.NoError(t, err)
+
+	// create doc1 rev 1-0335a345b6ffed05707ccc4cbc1b67f4, which is always sent as a full body
+	readBytesStart := dbStats.DocReadsBytesBlip.Value()
+	readBytesUncompressedStart := dbStats.DocReadsBytesBlipUncompressed.Value()
+	resp := rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"greetings": [{"hello": "world!"}, {"hi": "alice"}]}`)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	_, ok := client.WaitForRev("doc1", "1-0335a345b6ffed05707ccc4cbc1b67f4")
+	assert.True(t, ok)
+
+	readBytes := dbStats.DocReadsBytesBlip.Value() - readBytesStart
+	assert.True(t, readBytes > 0)
+	assert.Equal(t, readBytes, dbStats.DocReadsBytesBlipUncompressed.Value()-readBytesUncompressedStart)
+
+	// create doc1 rev 2-26359894b20d89c97638e71c40482f28, which is sent as a delta in EE
+	readBytesStart = dbStats.DocReadsBytesBlip.Value()
+	readBytesUncompressedStart = dbStats.DocReadsBytesBlipUncompressed.Value()
+	resp = rt.SendAdminRequest(http.MethodPut, "/db/doc1?rev=1-0335a345b6ffed05707ccc4cbc1b67f4", `{"greetings": [{"hello": "world!"}, {"hi": "alice"}, {"howdy": 12345678901234567890}]}`)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	_, ok = client.WaitForRev("doc1", "2-26359894b20d89c97638e71c40482f28")
+	assert.True(t, ok)
+
+	readBytes = dbStats.DocReadsBytesBlip.Value() - readBytesStart
+	readBytesUncompressed := dbStats.DocReadsBytesBlipUncompressed.Value() - readBytesUncompressedStart
+	if base.IsEnterpriseEdition() {
+		assert.Equal(t, int64(len(`{"greetings":{"2-":[{"howdy":12345678901234567890}]}}`)), readBytes)
+		assert.Equal(t, int64(len(`{"greetings":[{"hello":"world!"},{"hi":"alice"},{"howdy":12345678901234567890}]}`)), readBytesUncompressed)
+	} else {
+		assert.Equal(t, readBytes, readBytesUncompressed)
+	}
+
+	// create doc1 rev 3-abcxyz on client, which is pushed as a delta in EE
+	writeBytesStart := dbStats.DocWritesBytesBlip.Value()
+	writeBytesUncompressedStart := dbStats.DocWritesBytesBlipUncompressed.Value()
+	newRev, err := client.PushRev("doc1", "2-26359894b20d89c97638e71c40482f28", []byte(`{"greetings":[{"hello":"world!"},{"hi":"alice"},{"howdy":"bob"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "3-abcxyz", newRev)
+
+	writeBytes := dbStats.DocWritesBytesBlip.Value() - writeBytesStart
+	writeBytesUncompressed := dbStats.DocWritesBytesBlipUncompressed.Value() - writeBytesUncompressedStart
+	assert.True(t, writeBytes > 0)
+	if base.IsEnterpriseEdition() {
+		assert.True(t, writeBytesUncompressed > writeBytes, "expected uncompressed bytes %d to exceed delta bytes %d", writeBytesUncompressed, writeBytes)
+	} else {
+		assert.Equal(t, writeBytes, writeBytesUncompressed)
+	}
+}
+
 // TestBlipDeltaSyncNewAttachmentPull tests that adding a new attachment in SG and replicated via delta sync adds the attachment
 // to the temporary "allowedAttachments" map.
 func TestBlipDeltaSyncNewAttachmentPull(t *testing.T) {
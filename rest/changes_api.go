@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -37,6 +38,12 @@ const kDefaultTimeoutMS = 5 * 60 * 1000
 // Maximum value of _changes?timeout property
 const kMaxTimeoutMS = 15 * 60 * 1000
 
+// Default value of _changes?frame_size property, for feed=framed
+const kDefaultFrameSize = 100
+
+// Default value of _changes?frame_interval property, for feed=framed
+const kDefaultFrameIntervalMS = 1000
+
 func (h *handler) handleRevsDiff() error {
 	var input map[string][]string
 	err := h.readJSONInto(&input)
@@ -313,6 +320,8 @@ func (h *handler) handleChanges() error {
 		err, forceClose = h.sendSimpleChanges(userChannels, options, nil)
 	case "continuous":
 		err, forceClose = h.sendContinuousChangesByHTTP(userChannels, options)
+	case "framed":
+		err, forceClose = h.sendFramedChangesByHTTP(userChannels, options)
 	case "websocket":
 		err, forceClose = h.sendContinuousChangesByWebSocket(userChannels, options)
 	default:
@@ -475,6 +484,110 @@ func (h *handler) sendContinuousChangesByHTTP(inChannels base.Set, options db.Ch
 	})
 }
 
+// A feed=framed response is a continuous feed sent as a stream of newline-terminated frames, each in the shape of a
+// feed=normal response - {"results":[...],"last_seq":"..."} - for clients expecting complete JSON responses.  A frame
+// is sent once frame_size entries are pending, every frame_interval ms when any entries are pending, and as a final
+// frame when the feed closes.  Each frame's last_seq is its last entry's sequence, so can be used as since to
+// resume the feed.
+func (h *handler) sendFramedChangesByHTTP(inChannels base.Set, options db.ChangesOptions) (error, bool) {
+	frameSize := int(h.getIntQuery("frame_size", kDefaultFrameSize))
+	frameInterval := time.Duration(h.getIntQuery("frame_interval", kDefaultFrameIntervalMS)) * time.Millisecond
+	if frameSize <= 0 || frameInterval <= 0 {
+		return base.HTTPErrorf(http.StatusBadRequest, "frame_size and frame_interval must be positive"), false
+	}
+
+	h.setHeader("Content-Type", "application/octet-stream")
+	h.setHeader("Cache-Control", "private, max-age=0, no-cache, no-store")
+	h.logStatus(http.StatusOK, "sending framed feed")
+
+	framer := &changesFramer{
+		frameSize: frameSize,
+		write: func(data []byte) error {
+			_, err := h.response.Write(data)
+			h.flush()
+			return err
+		},
+	}
+	done := make(chan struct{})
+	go framer.sendOnInterval(frameInterval, done)
+	err, forceClose := h.generateContinuousChanges(inChannels, options, framer.send)
+	close(done)
+
+	// Send the final frame - a no-op if a previous write failed
+	_ = framer.flush()
+	return err, forceClose
+}
+
+// Serializes a continuous feed's entries into frames for feed=framed.  Frames are written by the feed goroutine (via
+// send), and on the interval timer, so writes are serialized by lock.
+type changesFramer struct {
+	frameSize int
+	write     func(data []byte) error
+	lock      sync.Mutex
+	pending   []*db.ChangeEntry
+	err       error // First write error, returned by subsequent sends to terminate the feed
+}
+
+// Send callback for generateContinuousChanges.  A nil changes (sent while the feed is waiting) is written as a
+// heartbeat newline.
+func (f *changesFramer) send(changes []*db.ChangeEntry) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if changes == nil {
+		f.err = f.write([]byte("\n"))
+		return f.err
+	}
+	f.pending = append(f.pending, changes...)
+	for len(f.pending) >= f.frameSize && f.err == nil {
+		f._writeFrame(f.frameSize)
+	}
+	return f.err
+}
+
+// Writes a frame holding the first count pending entries.  Requires lock.
+func (f *changesFramer) _writeFrame(count int) {
+	frame := struct {
+		Results []*db.ChangeEntry `json:"results"`
+		LastSeq string            `json:"last_seq"`
+	}{
+		Results: f.pending[:count],
+		LastSeq: f.pending[count-1].Seq.String(),
+	}
+	data, err := base.JSONMarshal(frame)
+	if err == nil {
+		err = f.write(append(data, '\n'))
+	}
+	f.pending = f.pending[count:]
+	f.err = err
+}
+
+// Writes any pending entries as a frame.
+func (f *changesFramer) flush() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err == nil && len(f.pending) > 0 {
+		f._writeFrame(len(f.pending))
+	}
+	return f.err
+}
+
+// Flushes pending entries every interval, until done is closed.
+func (f *changesFramer) sendOnInterval(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_ = f.flush()
+		}
+	}
+}
+
 func (h *handler) sendContinuousChangesByWebSocket(inChannels base.Set, options db.ChangesOptions) (error, bool) {
 
 	forceClose := false
@@ -10,13 +10,16 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -225,6 +228,51 @@ func TestPostChanges(t *testing.T) {
 
 }
 
+func TestChangesFramed(t *testing.T) {
+
+	defer base.SetUpTestLogging(base.LevelInfo, base.KeyChanges, base.KeyHTTP)()
+
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	for i := 1; i <= 3; i++ {
+		response := rt.SendAdminRequest("PUT", fmt.Sprintf("/db/doc%d", i), `{"channels":["PBS"]}`)
+		assertStatus(t, response, 201)
+	}
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	response := rt.SendAdminRequest("GET", "/db/_changes?feed=framed&since=0&timeout=500&frame_size=2&frame_interval=60000", "")
+	assertStatus(t, response, 200)
+
+	// Expect a full frame as soon as two entries are pending, and the remaining entry in the final frame
+	type changesFrame struct {
+		Results []db.ChangeEntry `json:"results"`
+		LastSeq db.SequenceID    `json:"last_seq"`
+	}
+	var frames []changesFrame
+	for _, line := range bytes.Split(response.Body.Bytes(), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var frame changesFrame
+		require.NoError(t, base.JSONUnmarshal(line, &frame))
+		frames = append(frames, frame)
+	}
+	require.Len(t, frames, 2)
+	require.Len(t, frames[0].Results, 2)
+	require.Len(t, frames[1].Results, 1)
+	assert.Equal(t, "doc1", frames[0].Results[0].ID)
+	assert.Equal(t, "doc2", frames[0].Results[1].ID)
+	assert.Equal(t, "doc3", frames[1].Results[0].ID)
+	for _, frame := range frames {
+		assert.Equal(t, frame.Results[len(frame.Results)-1].Seq, frame.LastSeq)
+	}
+
+	// Frame settings must be positive
+	response = rt.SendAdminRequest("GET", "/db/_changes?feed=framed&since=0&frame_size=0", "")
+	assertStatus(t, response, 400)
+}
+
 // Tests race between waking up the changes feed, and detecting that the user doc has changed
 func TestPostChangesUserTiming(t *testing.T) {
 
@@ -3659,3 +3707,84 @@ func WriteDirectWithKey(testDb *db.DatabaseContext, key string, channelArray []s
 		base.Panicf("Error while add ket to bucket: %v", err)
 	}
 }
+
+// pipeResponseWriter passes a handler's response body through a pipe, so that a test can read a continuous feed as
+// it's written.
+type pipeResponseWriter struct {
+	*httptest.ResponseRecorder
+	writer *io.PipeWriter
+}
+
+func (w *pipeResponseWriter) Write(data []byte) (int, error) {
+	return w.writer.Write(data)
+}
+
+// Tests that a continuous feed with a limit doesn't count backfill markers towards it.
+func TestContinuousChangesLimitBackfillMarkers(t *testing.T) {
+
+	defer base.SetUpTestLogging(base.LevelInfo, base.KeyChanges)()
+
+	rt := NewRestTester(t, &RestTesterConfig{SyncFn: `function(doc) {channel(doc.channels);}`})
+	defer rt.Close()
+
+	// User with access to ABC (sequence 1), doc1 in ABC and PBS (sequence 2), then the grant of PBS (sequence 3)
+	response := rt.SendAdminRequest(http.MethodPut, "/db/_user/bernard", `{"password":"letmein", "admin_channels":["ABC"]}`)
+	assertStatus(t, response, http.StatusCreated)
+	response = rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"channels":["ABC", "PBS"]}`)
+	assertStatus(t, response, http.StatusCreated)
+	response = rt.SendAdminRequest(http.MethodPut, "/db/_user/bernard", `{"admin_channels":["ABC", "PBS"]}`)
+	assertStatus(t, response, http.StatusOK)
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	database, err := db.CreateDatabase(rt.GetDatabase())
+	require.NoError(t, err)
+	user, err := database.Authenticator().GetUser("bernard")
+	require.NoError(t, err)
+	database.SetUser(user)
+
+	reader, writer := io.Pipe()
+	h := &handler{
+		server:   rt.ServerContext(),
+		rq:       httptest.NewRequest(http.MethodGet, "/db/_changes?feed=continuous", nil),
+		response: &pipeResponseWriter{ResponseRecorder: httptest.NewRecorder(), writer: writer},
+		db:       database,
+	}
+
+	options := db.ChangesOptions{
+		Limit:           4,
+		BackfillMarkers: true,
+		TimeoutMs:       10000,
+		Terminator:      make(chan bool),
+	}
+	defer close(options.Terminator)
+	go func() {
+		_, _ = h.sendContinuousChangesByHTTP(base.SetOf("*"), options)
+		_ = writer.Close()
+	}()
+
+	// The initial entries are doc1, its backfill from PBS, the PBS backfill marker and the user doc - only three of
+	// which count towards the limit
+	var entries []db.ChangeEntry
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry db.ChangeEntry
+		require.NoError(t, base.JSONUnmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+		if len(entries) == 4 {
+			// The feed is still open, so sends doc2 before closing at the limit
+			response = rt.SendAdminRequest(http.MethodPut, "/db/doc2", `{"channels":["ABC"]}`)
+			assertStatus(t, response, http.StatusCreated)
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, entries, 5)
+	assert.Equal(t, "doc1", entries[0].ID)
+	assert.Equal(t, "doc1", entries[1].ID)
+	assert.Equal(t, base.SetOf("PBS"), entries[2].BackfillComplete)
+	assert.Equal(t, "_user/bernard", entries[3].ID)
+	assert.Equal(t, "doc2", entries[4].ID)
+}
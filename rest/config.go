@@ -196,6 +196,22 @@ type DbConfig struct {
 	SGReplicateWebsocketPingInterval *int                             `json:"sgreplicate_websocket_heartbeat_secs,omitempty"` // If set, uses this duration as a custom heartbeat interval for websocket ping frames
 	Replications                     map[string]*db.ReplicationConfig `json:"replications,omitempty"`                         // sg-replicate replication definitions
 	ServeInsecureAttachmentTypes     bool                             `json:"serve_insecure_attachment_types,omitempty"`      // Attachment content type will bypass the content-disposition handling, default false
+	AttachmentTransferLogSize        *int                             `json:"attachment_transfer_log_size,omitempty"`         // Number of the largest pushed attachments to record with their doc IDs in expvars, for debugging
+	ChangesFeed                      *ChangesFeedConfig               `json:"changes_feed,omitempty"`                         // Config for changes feeds
+	MaxConcurrentAttachmentFetches   *int                             `json:"max_concurrent_attachment_fetches,omitempty"`    // Max number of attachments fetched for replication clients at once - zero means no limit
+	AttachmentFetchWaitMs            *int                             `json:"attachment_fetch_wait_ms,omitempty"`             // How long an attachment fetch waits for a slot when max_concurrent_attachment_fetches is reached (default 5000) - zero rejects fetches immediately
+}
+
+type ChangesFeedConfig struct {
+	MaxConcurrentFeeds                  *int `json:"max_concurrent_feeds,omitempty"`                   // Max number of changes feeds that may be active at once - zero means no limit
+	MaxConcurrentFeedsWaitMs            *int `json:"max_concurrent_feeds_wait_ms,omitempty"`           // How long a new feed waits for a slot when max_concurrent_feeds is reached
+	QueryRetryAttempts                  *int `json:"query_retry_attempts,omitempty"`                   // Number of times a failed channel changes query is retried
+	QueryRetryDelayMs                   *int `json:"query_retry_delay_ms,omitempty"`                   // Delay before the first retry of a failed channel changes query, doubled for each subsequent retry
+	WakeupJitterMaxMs                   *int `json:"wakeup_jitter_max_ms,omitempty"`                   // Max random delay before a woken continuous feed re-fetches changes
+	ExpandedChannelsWarningThreshold    *int `json:"expanded_channels_warning_threshold,omitempty"`    // Channels available to a feed's user above which a warning is logged - negative disables
+	BackfillEntriesWarningThreshold     *int `json:"backfill_entries_warning_threshold,omitempty"`     // Backfilled entries sent by a feed above which a warning is logged - negative disables
+	UnproductiveWakeupsWarningThreshold *int `json:"unproductive_wakeups_warning_threshold,omitempty"` // Consecutive wakeups of a feed without sending anything at which a warning is logged - negative disables
+	MaxRemovedChannels                  *int `json:"max_removed_channels,omitempty"`                   // Max number of channels listed in a changes entry's removed set - zero means no limit
 }
 
 type DeltaSyncConfig struct {
@@ -709,6 +725,7 @@ func (config *ServerConfig) SetupAndValidateLogging() (warnings []base.DeferredL
 	warnings = config.deprecatedConfigLoggingFallback()
 
 	base.SetRedaction(config.Logging.RedactionLevel)
+	base.JSONLogging = config.Logging.JSON
 
 	warningsInit, err := config.Logging.Init(defaultLogFilePath)
 	warnings = append(warnings, warningsInit...)
@@ -36,6 +36,7 @@ const kStatsReportInterval = time.Hour
 const kDefaultSlowQueryWarningThreshold = 500 // ms
 const KDefaultNumShards = 16
 const DefaultStatsLogFrequencySecs = 60
+const kDefaultAttachmentFetchWaitMs = 5000 // When max_concurrent_attachment_fetches is set without attachment_fetch_wait_ms
 
 // Shared context of HTTP handlers: primarily a registry of databases by name. It also stores
 // the configuration settings so handlers can refer to them.
@@ -711,6 +712,37 @@ func dbcOptionsFromConfig(sc *ServerContext, config *DbConfig, dbName string) (d
 		localDocExpirySecs = *config.LocalDocExpirySecs
 	}
 
+	var changesFeedOptions db.ChangesFeedOptions
+	if config.ChangesFeed != nil {
+		if maxFeeds := config.ChangesFeed.MaxConcurrentFeeds; maxFeeds != nil {
+			changesFeedOptions.MaxConcurrentFeeds = *maxFeeds
+		}
+		if waitMs := config.ChangesFeed.MaxConcurrentFeedsWaitMs; waitMs != nil {
+			changesFeedOptions.MaxConcurrentFeedsWait = time.Duration(*waitMs) * time.Millisecond
+		}
+		if retryAttempts := config.ChangesFeed.QueryRetryAttempts; retryAttempts != nil {
+			changesFeedOptions.QueryRetryAttempts = *retryAttempts
+		}
+		if retryDelayMs := config.ChangesFeed.QueryRetryDelayMs; retryDelayMs != nil {
+			changesFeedOptions.QueryRetryDelay = time.Duration(*retryDelayMs) * time.Millisecond
+		}
+		if jitterMs := config.ChangesFeed.WakeupJitterMaxMs; jitterMs != nil {
+			changesFeedOptions.WakeupJitterMax = time.Duration(*jitterMs) * time.Millisecond
+		}
+		if threshold := config.ChangesFeed.ExpandedChannelsWarningThreshold; threshold != nil {
+			changesFeedOptions.Thresholds.ExpandedChannels = *threshold
+		}
+		if threshold := config.ChangesFeed.BackfillEntriesWarningThreshold; threshold != nil {
+			changesFeedOptions.Thresholds.BackfillEntries = *threshold
+		}
+		if threshold := config.ChangesFeed.UnproductiveWakeupsWarningThreshold; threshold != nil {
+			changesFeedOptions.Thresholds.UnproductiveWakeups = *threshold
+		}
+		if maxRemoved := config.ChangesFeed.MaxRemovedChannels; maxRemoved != nil {
+			changesFeedOptions.MaxRemovedChannels = *maxRemoved
+		}
+	}
+
 	contextOptions := db.DatabaseContextOptions{
 		CacheOptions:              &cacheOptions,
 		RevisionCacheOptions:      revCacheOptions,
@@ -734,6 +766,18 @@ func dbcOptionsFromConfig(sc *ServerContext, config *DbConfig, dbName string) (d
 			WebsocketPingInterval: sgReplicateWebsocketPingInterval,
 		},
 		SlowQueryWarningThreshold: time.Duration(*sc.config.SlowQueryWarningThreshold) * time.Millisecond,
+		ChangesFeedOptions:        changesFeedOptions,
+	}
+	if config.AttachmentTransferLogSize != nil {
+		contextOptions.AttachmentTransferLogSize = *config.AttachmentTransferLogSize
+	}
+	if config.MaxConcurrentAttachmentFetches != nil {
+		contextOptions.MaxConcurrentAttachmentFetches = *config.MaxConcurrentAttachmentFetches
+		// Fetches beyond the limit queue for a while by default, rather than being rejected
+		contextOptions.AttachmentFetchWait = kDefaultAttachmentFetchWaitMs * time.Millisecond
+	}
+	if config.AttachmentFetchWaitMs != nil {
+		contextOptions.AttachmentFetchWait = time.Duration(*config.AttachmentFetchWaitMs) * time.Millisecond
 	}
 
 	return contextOptions, nil
@@ -21,6 +21,7 @@ import (
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Tests the ConfigServer feature.
@@ -273,6 +274,30 @@ func TestGetOrAddDatabaseFromConfig(t *testing.T) {
 	assert.Equal(t, bucketName, dbContext.BucketSpec.BucketName)
 }
 
+func TestAttachmentFetchWaitFromConfig(t *testing.T) {
+	serverConfig := &ServerConfig{CORS: &CORSConfig{}, AdminInterface: &DefaultAdminInterface}
+	serverContext := NewServerContext(serverConfig)
+	defer serverContext.Close()
+
+	server := "walrus:"
+	maxFetches := 2
+	fetchWaitMs := 0
+
+	// Fetches beyond the limit wait by default
+	bucketName := "fetchdefault"
+	dbConfig := &DbConfig{BucketConfig: BucketConfig{Server: &server, Bucket: &bucketName}, Name: bucketName, MaxConcurrentAttachmentFetches: &maxFetches}
+	dbContext, err := serverContext.AddDatabaseFromConfig(dbConfig)
+	require.NoError(t, err)
+	assert.Equal(t, kDefaultAttachmentFetchWaitMs*time.Millisecond, dbContext.Options.AttachmentFetchWait)
+
+	// An explicit zero wait rejects them immediately
+	bucketName = "fetchnowait"
+	dbConfig = &DbConfig{BucketConfig: BucketConfig{Server: &server, Bucket: &bucketName}, Name: bucketName, MaxConcurrentAttachmentFetches: &maxFetches, AttachmentFetchWaitMs: &fetchWaitMs}
+	dbContext, err = serverContext.AddDatabaseFromConfig(dbConfig)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), dbContext.Options.AttachmentFetchWait)
+}
+
 func TestStatsLoggerStopped(t *testing.T) {
 	defer base.SetUpTestLogging(base.LevelDebug, base.KeyAll)()
 